@@ -0,0 +1,29 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EncodeAttributes encodes each attribute value as JSON, for adapters
+// building a core.Log from their logger's fields. The log is sent some time
+// after it is built, so this keeps later changes to a value out of it, and
+// reports values which cannot be encoded while the caller can still be
+// told. It returns nil if there are no attributes.
+func EncodeAttributes(attrs map[string]any) (map[string]any, error) {
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	encoded := make(map[string]any, len(attrs))
+	for key, value := range attrs {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", key, err)
+		}
+
+		encoded[key] = json.RawMessage(raw)
+	}
+
+	return encoded, nil
+}
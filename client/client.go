@@ -1 +1,390 @@
 package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+// This package provides the client used by services to ship their logs to
+// a loggui server. Logs are queued in memory, batched and sent in the
+// background.
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultQueueSize     = 10000
+	DefaultMaxRetries    = 5
+	DefaultMinBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff    = 30 * time.Second
+	DefaultJitter        = 0.2
+	DefaultTimeout       = 10 * time.Second
+
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 10 * time.Second
+)
+
+var (
+	ErrClosed    = errors.New("client is closed")
+	ErrQueueFull = errors.New("queue is full")
+)
+
+// Sender is anything that can ship logs to loggui. Client is the default
+// implementation and the logger adapters accept any Sender.
+type Sender interface {
+	Send(log *core.Log) error
+	Flush(ctx context.Context) error
+}
+
+// Config configures a Client. Only URL is required, every other field
+// falls back to its default when left empty.
+//
+// Username/Password are sent as basic auth. If Token is set it is sent as a
+// bearer token instead, which the server accepts if it is one of its
+// Config.Tokens.
+type Config struct {
+	// URL is the base URL of the loggui server, e.g. http://localhost:8080
+	URL string
+
+	Username string
+	Password string
+	Token    string
+
+	// BatchSize is the number of logs sent in a single request.
+	BatchSize int
+
+	// FlushInterval is the longest a log waits in the queue before its
+	// batch is sent, even if the batch is not full.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of logs held in memory. Logs sent while the
+	// queue is full are dropped.
+	QueueSize int
+
+	// MaxRetries is the number of times a failed batch is sent again. Set
+	// to a negative value to disable retries.
+	MaxRetries int
+
+	// MinBackoff is the delay before the first retry. It doubles on every
+	// further retry up to MaxBackoff. A Retry-After sent by the server with
+	// a 429 or 503 takes precedence, but is also capped at MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of each backoff that is randomised, so that
+	// clients do not retry in lockstep. Set to a negative value to disable.
+	Jitter float64
+
+	// BreakerThreshold is the number of consecutive failed requests that
+	// opens the circuit breaker. While open, batches are not sent.
+	BreakerThreshold int
+
+	// BreakerCooldown is how long the breaker stays open before a single
+	// probe batch is let through to check if the server has recovered.
+	BreakerCooldown time.Duration
+
+	// SpoolDir enables the on-disk spool. Batches that cannot be delivered
+	// are written to it instead of being dropped, and replayed in order
+	// once the server is reachable again.
+	SpoolDir string
+
+	// SpoolMaxBytes and SpoolMaxAge limit the spool. When either is
+	// exceeded the oldest batches are dropped.
+	SpoolMaxBytes int64
+	SpoolMaxAge   time.Duration
+
+	// HTTPClient is used to send requests. Defaults to a client with
+	// DefaultTimeout.
+	HTTPClient *http.Client
+}
+
+func (c Config) withDefaults() Config {
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFlushInterval
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	} else if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = DefaultMinBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = max(DefaultMaxBackoff, c.MinBackoff)
+	}
+	if c.Jitter < 0 {
+		c.Jitter = 0
+	} else if c.Jitter == 0 {
+		c.Jitter = DefaultJitter
+	} else if c.Jitter > 1 {
+		c.Jitter = 1
+	}
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if c.SpoolMaxBytes <= 0 {
+		c.SpoolMaxBytes = DefaultSpoolMaxBytes
+	}
+	if c.SpoolMaxAge <= 0 {
+		c.SpoolMaxAge = DefaultSpoolMaxAge
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return c
+}
+
+// Stats are the counters of a Client since it was created.
+//
+// Sent is the number of logs accepted by the server, Dropped is the number
+// of logs that will never be delivered, and Retried is the number of
+// batches that were sent again after a failure. BreakerTrips is the number
+// of times the circuit breaker has opened.
+//
+// Spooled is the number of logs written to the spool, and SpoolCorrupted is
+// the number of spool records skipped because they failed their checksum.
+type Stats struct {
+	Sent    uint64
+	Dropped uint64
+	Retried uint64
+
+	Breaker      BreakerState
+	BreakerTrips uint64
+
+	Spooled        uint64
+	SpoolCorrupted uint64
+}
+
+// flushRequest asks the run loop to send everything queued so far.
+type flushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+// Client batches logs and ships them to a loggui server.
+//
+// Implements Sender
+type Client struct {
+	config  Config
+	sender  *httpSender
+	breaker *breaker
+	spool   *spool
+
+	queue   chan *core.Log
+	flushes chan flushRequest
+	closing chan flushRequest
+	done    chan struct{}
+
+	// stopped is closed when Close returns, so that the logs still being
+	// sent in the background stop waiting to be retried
+	stopped chan struct{}
+
+	closeLock sync.RWMutex
+	closed    bool
+
+	sent           atomic.Uint64
+	dropped        atomic.Uint64
+	retried        atomic.Uint64
+	spooled        atomic.Uint64
+	spoolCorrupted atomic.Uint64
+}
+
+func New(config Config) (*Client, error) {
+	if config.URL == "" {
+		return nil, errors.New("url is required")
+	}
+
+	config = config.withDefaults()
+	c := &Client{
+		config:  config,
+		queue:   make(chan *core.Log, config.QueueSize),
+		flushes: make(chan flushRequest),
+		closing: make(chan flushRequest),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		breaker: newBreaker(config.BreakerThreshold, config.BreakerCooldown),
+	}
+
+	sender, err := newHTTPSender(c)
+	if err != nil {
+		return nil, err
+	}
+	c.sender = sender
+
+	if config.SpoolDir != "" {
+		c.spool, err = openSpool(config.SpoolDir, config.SpoolMaxBytes, config.SpoolMaxAge)
+		if err != nil {
+			return nil, err
+		}
+
+		c.spool.dropped = func(count int) { c.dropped.Add(uint64(count)) }
+		c.spool.corrupted = func() { c.spoolCorrupted.Add(1) }
+		c.spool.trim()
+	}
+
+	go c.run()
+
+	return c, nil
+}
+
+// Send queues the log to be sent. It never blocks, if the queue is full
+// the log is dropped and ErrQueueFull is returned.
+//
+// A log without an ID is given one. It is sent with every retry and replay
+// from the spool, so that the server stores the log once however many
+// times it is delivered.
+func (c *Client) Send(log *core.Log) error {
+	if log == nil {
+		return errors.New("log is nil")
+	}
+
+	if log.ID == "" {
+		log.ID = core.NewID()
+	}
+
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	select {
+	case c.queue <- log:
+		return nil
+	default:
+		c.dropped.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// Flush sends every log queued before the call and waits for the server to
+// respond, or for ctx to be done. Logs that could not be delivered but were
+// written to the spool are not reported as an error.
+func (c *Client) Flush(ctx context.Context) error {
+	return c.request(ctx, c.flushes)
+}
+
+// Close stops accepting new logs and drains the queue. If ctx is done
+// before the queue is drained, the remaining logs continue to be sent in
+// the background, without waiting to retry, and ctx.Err() is returned.
+// Logs left in the spool are replayed by the next Client opened on the same
+// SpoolDir.
+func (c *Client) Close(ctx context.Context) error {
+	c.closeLock.Lock()
+	if c.closed {
+		c.closeLock.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.closeLock.Unlock()
+	defer close(c.stopped)
+
+	return c.request(ctx, c.closing)
+}
+
+func (c *Client) Stats() Stats {
+	state, trips := c.breaker.stats()
+
+	return Stats{
+		Sent:         c.sent.Load(),
+		Dropped:      c.dropped.Load(),
+		Retried:      c.retried.Load(),
+		Breaker:      state,
+		BreakerTrips: trips,
+
+		Spooled:        c.spooled.Load(),
+		SpoolCorrupted: c.spoolCorrupted.Load(),
+	}
+}
+
+func (c *Client) request(ctx context.Context, to chan<- flushRequest) error {
+	req := flushRequest{ctx: ctx, done: make(chan error, 1)}
+
+	select {
+	case to <- req:
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run owns the current batch. It sends it when it is full, when the
+// flush interval elapses, or when asked to by Flush or Close.
+func (c *Client) run() {
+	defer close(c.done)
+
+	if c.spool != nil {
+		defer c.spool.close()
+	}
+
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*core.Log, 0, c.config.BatchSize)
+	send := func(ctx context.Context) error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := c.sender.send(ctx, batch)
+		batch = make([]*core.Log, 0, c.config.BatchSize)
+		return err
+	}
+
+	// drain sends everything currently in the queue
+	drain := func(ctx context.Context) error {
+		var errs []error
+		for n := len(c.queue); n > 0; n-- {
+			batch = append(batch, <-c.queue)
+			if len(batch) >= c.config.BatchSize {
+				errs = append(errs, send(ctx))
+			}
+		}
+
+		errs = append(errs, send(ctx), c.sender.replay(ctx))
+		return errors.Join(errs...)
+	}
+
+	for {
+		select {
+		case log := <-c.queue:
+			batch = append(batch, log)
+			if len(batch) >= c.config.BatchSize {
+				_ = send(context.Background())
+			}
+		case <-ticker.C:
+			_ = send(context.Background())
+			_ = c.sender.replay(context.Background())
+		case req := <-c.flushes:
+			req.done <- drain(req.ctx)
+		case req := <-c.closing:
+			req.done <- drain(context.WithoutCancel(req.ctx))
+			return
+		}
+	}
+}
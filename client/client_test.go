@@ -0,0 +1,305 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+// testServer records the batches received on the ingest endpoint. Each
+// request is answered with the status returned by respond, which defaults
+// to 200.
+type testServer struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	batches  [][]*core.Log
+	requests atomic.Int32
+	respond  func(r *http.Request) int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+
+		if s.respond != nil {
+			if status := s.respond(r); status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+
+		if r.URL.Path != ingestPath || r.Header.Get("Content-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var batch []*core.Log
+		if err := json.NewDecoder(zr).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.mutex.Lock()
+		s.batches = append(s.batches, batch)
+		s.mutex.Unlock()
+
+		_ = json.NewEncoder(w).Encode(ingestResponse{Accepted: len(batch)})
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testServer) received() [][]*core.Log {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]*core.Log(nil), s.batches...)
+}
+
+func newTestClient(t *testing.T, config Config) *Client {
+	c, err := New(config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	t.Cleanup(func() { _ = c.Close(context.Background()) })
+	return c
+}
+
+func testLog(msg string) *core.Log {
+	return &core.Log{Level: core.INFO, Message: msg, RecordedAt: time.Now()}
+}
+
+func TestNew_RequiresURL(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Errorf("expected error for missing url")
+	}
+}
+
+func TestClient_BatchSize(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, Config{URL: srv.URL, BatchSize: 2, FlushInterval: time.Hour})
+
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		if err := c.Send(testLog(msg)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	batches := srv.received()
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(batches))
+	}
+
+	for i, size := range []int{2, 2, 1} {
+		if len(batches[i]) != size {
+			t.Errorf("batch %d: expected %d logs, got %d", i, size, len(batches[i]))
+		}
+	}
+
+	if got := c.Stats(); got.Sent != 5 || got.Dropped != 0 {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestClient_FlushInterval(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, Config{URL: srv.URL, FlushInterval: 10 * time.Millisecond})
+
+	_ = c.Send(testLog("a"))
+
+	deadline := time.Now().Add(time.Second)
+	for len(srv.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch was not sent after the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClient_Auth(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		check  func(r *http.Request) bool
+	}{
+		{
+			name:   "basic",
+			config: Config{Username: "user", Password: "pass"},
+			check: func(r *http.Request) bool {
+				u, p, ok := r.BasicAuth()
+				return ok && u == "user" && p == "pass"
+			},
+		},
+		{
+			name:   "token",
+			config: Config{Username: "user", Token: "secret"},
+			check: func(r *http.Request) bool {
+				return r.Header.Get("Authorization") == "Bearer secret"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			srv.respond = func(r *http.Request) int {
+				if !tt.check(r) {
+					return http.StatusUnauthorized
+				}
+				return http.StatusOK
+			}
+
+			tt.config.URL = srv.URL
+			c := newTestClient(t, tt.config)
+			_ = c.Send(testLog("a"))
+
+			if err := c.Flush(context.Background()); err != nil {
+				t.Errorf("Flush() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int {
+		<-release
+		return http.StatusOK
+	}
+
+	c := newTestClient(t, Config{URL: srv.URL, BatchSize: 1, QueueSize: 1})
+
+	// The first log is taken by the run loop which blocks on the server,
+	// the second fills the queue and the third is dropped.
+	_ = c.Send(testLog("a"))
+	for srv.requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_ = c.Send(testLog("b"))
+	if err := c.Send(testLog("c")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+
+	close(release)
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if got := c.Stats(); got.Sent != 2 || got.Dropped != 1 {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int {
+		if srv.requests.Load() == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+
+	c := newTestClient(t, Config{URL: srv.URL, MinBackoff: time.Millisecond})
+	_ = c.Send(testLog("a"))
+
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if got := c.Stats(); got.Sent != 1 || got.Retried != 1 || got.Dropped != 0 {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestClient_ID(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, Config{URL: srv.URL})
+
+	own := testLog("own")
+	own.ID = "01J0000000000000000000000"
+	_ = c.Send(testLog("a"))
+	_ = c.Send(own)
+
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	var ids []string
+	for _, batch := range srv.received() {
+		for _, log := range batch {
+			ids = append(ids, log.ID)
+		}
+	}
+
+	if len(ids) != 2 || ids[0] == "" || ids[1] != own.ID {
+		t.Errorf("expected a new ID and the log's own, got %v", ids)
+	}
+}
+
+func TestClient_NoRetryOnClientError(t *testing.T) {
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int { return http.StatusBadRequest }
+
+	c := newTestClient(t, Config{URL: srv.URL, MinBackoff: time.Millisecond})
+	_ = c.Send(testLog("a"))
+
+	if err := c.Flush(context.Background()); err == nil {
+		t.Fatalf("expected Flush() to fail")
+	}
+
+	if got := c.Stats(); got.Retried != 0 || got.Dropped != 1 || srv.requests.Load() != 1 {
+		t.Errorf("unexpected stats %+v after %d requests", got, srv.requests.Load())
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(Config{URL: srv.URL, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for range 10 {
+		_ = c.Send(testLog("a"))
+	}
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got := c.Stats(); got.Sent != 10 {
+		t.Errorf("expected the queue to be drained, got %+v", got)
+	}
+
+	if err := c.Send(testLog("b")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	if err := c.Close(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed on second Close, got %v", err)
+	}
+}
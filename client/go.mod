@@ -1,3 +1,18 @@
 module github.com/m4tth3/loggui/client
 
 go 1.24.1
+
+require (
+	github.com/m4tth3/loggui/core v0.0.0-20250511175409-038d18c374cd
+	github.com/rs/zerolog v1.34.0
+	github.com/sirupsen/logrus v1.9.3
+	go.uber.org/zap v1.27.0
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
@@ -0,0 +1,84 @@
+// Package clienttest holds the fixtures shared by the tests of the client
+// and its adapters.
+package clienttest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+// Sender collects the logs it is sent.
+//
+// Implements client.Sender
+type Sender struct {
+	mutex   sync.Mutex
+	logs    []*core.Log
+	flushed int
+}
+
+func (s *Sender) Send(log *core.Log) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.logs = append(s.logs, log)
+	return nil
+}
+
+func (s *Sender) Flush(context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.flushed++
+	return nil
+}
+
+// Logs returns the logs sent so far, in order.
+func (s *Sender) Logs() []*core.Log {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*core.Log(nil), s.logs...)
+}
+
+// Flushed returns the number of times Flush was called.
+func (s *Sender) Flushed() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.flushed
+}
+
+// Last returns the last log sent, failing the test if there is none.
+func (s *Sender) Last(t *testing.T) *core.Log {
+	t.Helper()
+
+	logs := s.Logs()
+	if len(logs) == 0 {
+		t.Fatalf("no logs were sent")
+	}
+
+	return logs[len(logs)-1]
+}
+
+// DecodeAttributes returns the attributes as the server receives them,
+// through JSON. The message is expected to be plain, as the adapters send
+// their fields as attributes.
+func DecodeAttributes(t *testing.T, log *core.Log) map[string]any {
+	t.Helper()
+
+	if log.IsMessageJson {
+		t.Errorf("expected a plain message, got %q", log.Message)
+	}
+
+	encoded, err := json.Marshal(log.Attributes)
+	if err != nil {
+		t.Fatalf("attributes are not valid JSON: %v", err)
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(encoded, &m); err != nil {
+		t.Fatalf("attributes are not valid JSON: %v", err)
+	}
+
+	return m
+}
@@ -0,0 +1,160 @@
+package logrusadapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/m4tth3/loggui/client"
+	"github.com/m4tth3/loggui/core"
+	"github.com/sirupsen/logrus"
+)
+
+// This package provides a logrus.Hook which ships logrus entries to loggui,
+// e.g.
+//
+//	logger.AddHook(logrusadapter.NewHook(lc, nil))
+
+// Options configures a Hook.
+//
+// Source and Group are used for every log unless an entry has a string
+// field named SourceKey or GroupKey, whose value is used instead. Those
+// fields are not rendered into the message.
+type Options struct {
+	// Level is the least severe level that is sent. Defaults to
+	// logrus.InfoLevel when not set, so as PanicLevel is the zero value a
+	// hook cannot be limited to panics alone.
+	Level logrus.Level
+
+	Source string
+	Group  string
+
+	SourceKey string
+	GroupKey  string
+}
+
+// Hook converts logrus entries into core.Log and sends them through a
+// client.Sender. The fields become the log's Attributes, along with the
+// caller if the entry has one,
+//
+//	{"caller": "api/h.go:12", "func": "api.Handle", "status": 200}
+//
+// Implements logrus.Hook
+type Hook struct {
+	sender client.Sender
+	opts   Options
+}
+
+func NewHook(sender client.Sender, opts *Options) *Hook {
+	h := &Hook{sender: sender}
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	if h.opts.Level == logrus.PanicLevel {
+		h.opts.Level = logrus.InfoLevel
+	}
+
+	return h
+}
+
+// Levels returns every level at least as severe as Options.Level.
+func (h *Hook) Levels() []logrus.Level {
+	var levels []logrus.Level
+	for _, l := range logrus.AllLevels {
+		if l <= h.opts.Level {
+			levels = append(levels, l)
+		}
+	}
+
+	return levels
+}
+
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	var source, group *string
+	if h.opts.Source != "" {
+		source = &h.opts.Source
+	}
+	if h.opts.Group != "" {
+		group = &h.opts.Group
+	}
+
+	fields := make(map[string]any, len(entry.Data)+2)
+	for key, value := range entry.Data {
+		if s, ok := value.(string); ok {
+			switch {
+			case h.opts.SourceKey != "" && key == h.opts.SourceKey:
+				source = &s
+				continue
+			case h.opts.GroupKey != "" && key == h.opts.GroupKey:
+				group = &s
+				continue
+			}
+		}
+
+		fields[key] = fieldValue(value)
+	}
+
+	if entry.HasCaller() {
+		fields["caller"] = fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line)
+		fields["func"] = entry.Caller.Function
+	}
+
+	attributes, err := client.EncodeAttributes(fields)
+	if err != nil {
+		return err
+	}
+
+	recordedAt := entry.Time
+	if recordedAt.IsZero() {
+		recordedAt = time.Now()
+	}
+
+	err = h.sender.Send(&core.Log{
+		Level:      Level(entry.Level),
+		Source:     source,
+		Group:      group,
+		Message:    entry.Message,
+		RecordedAt: recordedAt,
+		Attributes: attributes,
+	})
+	if err != nil {
+		return err
+	}
+
+	// logrus panics or exits right after firing the hooks for these, so
+	// they have to be delivered now.
+	if entry.Level <= logrus.FatalLevel {
+		return h.sender.Flush(context.Background())
+	}
+
+	return nil
+}
+
+// fieldValue converts the value into something encoding/json renders well.
+// Errors are rendered by their message, as logrus' JSONFormatter does.
+func fieldValue(v any) any {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+
+	return v
+}
+
+// Level maps a logrus level onto core.Level. Panic is treated as FATAL.
+func Level(l logrus.Level) core.Level {
+	switch l {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return core.FATAL
+	case logrus.ErrorLevel:
+		return core.ERROR
+	case logrus.WarnLevel:
+		return core.WARN
+	case logrus.InfoLevel:
+		return core.INFO
+	case logrus.DebugLevel:
+		return core.DEBUG
+	default:
+		return core.TRACE
+	}
+}
@@ -0,0 +1,125 @@
+package logrusadapter
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/m4tth3/loggui/client/internal/clienttest"
+	"github.com/m4tth3/loggui/core"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger(hook *Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.TraceLevel)
+	logger.AddHook(hook)
+
+	return logger
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		level    logrus.Level
+		expected core.Level
+	}{
+		{logrus.TraceLevel, core.TRACE},
+		{logrus.DebugLevel, core.DEBUG},
+		{logrus.InfoLevel, core.INFO},
+		{logrus.WarnLevel, core.WARN},
+		{logrus.ErrorLevel, core.ERROR},
+		{logrus.FatalLevel, core.FATAL},
+		{logrus.PanicLevel, core.FATAL},
+	}
+
+	for _, tt := range tests {
+		if got := Level(tt.level); got != tt.expected {
+			t.Errorf("Level(%v) = %v, want %v", tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestHook_Fire(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := newTestLogger(NewHook(sender, &Options{
+		Level:     logrus.DebugLevel,
+		Source:    "default",
+		SourceKey: "service",
+		GroupKey:  "request_id",
+	}))
+
+	logger.WithFields(logrus.Fields{
+		"service":    "api",
+		"request_id": "abc",
+		"status":     200,
+	}).WithError(errors.New("timeout")).Debug("served")
+
+	if len(sender.Logs()) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(sender.Logs()))
+	}
+
+	log := sender.Logs()[0]
+	if log.Level != core.DEBUG || log.Message != "served" || log.IsMessageJson {
+		t.Errorf("unexpected log %+v", log)
+	}
+
+	if log.Source == nil || *log.Source != "api" || log.Group == nil || *log.Group != "abc" {
+		t.Errorf("unexpected source/group %v/%v", log.Source, log.Group)
+	}
+
+	m := clienttest.DecodeAttributes(t, log)
+	if m["status"] != float64(200) || m[logrus.ErrorKey] != "timeout" {
+		t.Errorf("unexpected attributes %v", m)
+	}
+
+	if _, ok := m["service"]; ok {
+		t.Errorf("source field should not be kept, got %v", m)
+	}
+}
+
+func TestHook_Levels(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := newTestLogger(NewHook(sender, nil))
+
+	logger.Debug("ignored")
+	logger.Info("sent")
+
+	if len(sender.Logs()) != 1 {
+		t.Errorf("expected only the info log, got %d logs", len(sender.Logs()))
+	}
+}
+
+func TestHook_DefaultLevel(t *testing.T) {
+	sender := &clienttest.Sender{}
+
+	// Options without a Level still default to info, rather than
+	// PanicLevel, the zero value
+	logger := newTestLogger(NewHook(sender, &Options{Source: "api"}))
+
+	logger.Debug("ignored")
+	logger.Warn("sent")
+
+	if len(sender.Logs()) != 1 || sender.Logs()[0].Message != "sent" {
+		t.Errorf("expected only the warn log, got %d logs", len(sender.Logs()))
+	}
+}
+
+func TestHook_Flush(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := newTestLogger(NewHook(sender, nil))
+
+	logger.Error("not flushed")
+	if sender.Flushed() != 0 {
+		t.Errorf("error logs should not flush")
+	}
+
+	func() {
+		defer func() { _ = recover() }()
+		logger.Panic("flushed")
+	}()
+
+	if sender.Flushed() != 1 {
+		t.Errorf("expected panic to flush, got %d flushes", sender.Flushed())
+	}
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+// LevelPrefix marks the lines starting with Prefix as Level.
+type LevelPrefix struct {
+	Prefix string
+	Level  core.Level
+}
+
+// DefaultLevelPrefixes are the level prefixes used when none are configured.
+var DefaultLevelPrefixes = []LevelPrefix{
+	{"[TRACE]", core.TRACE},
+	{"[DEBUG]", core.DEBUG},
+	{"[INFO]", core.INFO},
+	{"[WARN]", core.WARN},
+	{"[WARNING]", core.WARN},
+	{"[ERROR]", core.ERROR},
+	{"[FATAL]", core.FATAL},
+	{"[PANIC]", core.FATAL},
+}
+
+// LogWriterOptions configures a LogWriter.
+//
+// Flags and Prefix should match the ones the log.Logger writing to it was
+// created with, so that the header it adds to every line can be parsed. A
+// line which does not match them is sent as it is.
+type LogWriterOptions struct {
+	Source string
+	Group  string
+
+	// Flags are the log.Logger flags, e.g. log.LstdFlags.
+	Flags  int
+	Prefix string
+
+	// LevelPrefixes are matched case-insensitively against the start of the
+	// message and removed from it. Defaults to DefaultLevelPrefixes.
+	LevelPrefixes []LevelPrefix
+
+	// Level is used for lines without a level prefix. Defaults to INFO.
+	Level *core.Level
+}
+
+// LogWriter is an io.Writer which sends every line written to it through a
+// Sender, so it can be installed with log.SetOutput. The file:line of a
+// line's header, if any, is sent as the caller attribute,
+//
+//	{"caller": "api/h.go:12"}
+type LogWriter struct {
+	sender Sender
+	opts   LogWriterOptions
+
+	mutex sync.Mutex
+	// partial holds a line which has not been terminated yet
+	partial []byte
+}
+
+func NewLogWriter(sender Sender, opts *LogWriterOptions) *LogWriter {
+	w := &LogWriter{sender: sender}
+
+	if opts != nil {
+		w.opts = *opts
+	}
+
+	if w.opts.LevelPrefixes == nil {
+		w.opts.LevelPrefixes = DefaultLevelPrefixes
+	}
+
+	if w.opts.Level == nil {
+		level := core.INFO
+		w.opts.Level = &level
+	}
+
+	return w
+}
+
+// Write sends every complete line in p. An unterminated line is held until
+// the rest of it is written or Flush is called.
+//
+// If a line cannot be sent, Write returns the number of bytes of p before
+// it and the error. Nothing after them is kept, so they can be written
+// again.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	held := len(w.partial)
+	data := p
+	if held > 0 {
+		data = append(w.partial, p...)
+		w.partial = nil
+	}
+
+	// start is where the line being sent starts in data
+	for start := 0; ; {
+		i := bytes.IndexByte(data[start:], '\n')
+		if i < 0 {
+			if start < len(data) {
+				w.partial = bytes.Clone(data[start:])
+			}
+			return len(p), nil
+		}
+
+		if sent, err := w.send(data[start : start+i]); !sent {
+			// The part of the line held from before p is kept
+			if start < held {
+				w.partial = bytes.Clone(data[start:held])
+			}
+			return max(start-held, 0), err
+		} else if err != nil {
+			return start + i + 1 - held, err
+		}
+
+		start += i + 1
+	}
+}
+
+// Flush sends the unterminated line, if any, and flushes the sender.
+func (w *LogWriter) Flush(ctx context.Context) error {
+	w.mutex.Lock()
+	partial := w.partial
+	w.partial = nil
+
+	var err error
+	if len(partial) > 0 {
+		_, err = w.send(partial)
+	}
+	w.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return w.sender.Flush(ctx)
+}
+
+// send sends the line. sent reports whether it was handed to the sender,
+// as a FATAL line can fail to be flushed after.
+func (w *LogWriter) send(line []byte) (sent bool, err error) {
+	text := strings.TrimSuffix(string(line), "\r")
+	if strings.TrimSpace(text) == "" {
+		return true, nil
+	}
+
+	recordedAt, caller, msg, ok := parseLogHeader(text, w.opts.Flags, w.opts.Prefix)
+	if !ok {
+		recordedAt, caller, msg = time.Now(), "", text
+	}
+
+	level, msg := w.level(msg)
+
+	log := &core.Log{
+		Level:      level,
+		Message:    msg,
+		RecordedAt: recordedAt,
+	}
+
+	if w.opts.Source != "" {
+		log.Source = &w.opts.Source
+	}
+
+	if w.opts.Group != "" {
+		log.Group = &w.opts.Group
+	}
+
+	if caller != "" {
+		log.Attributes = map[string]any{"caller": caller}
+	}
+
+	if err := w.sender.Send(log); err != nil {
+		return false, err
+	}
+
+	// log.Fatal and log.Panic exit or panic right after writing, so these
+	// have to be delivered now.
+	if level == core.FATAL {
+		return true, w.sender.Flush(context.Background())
+	}
+
+	return true, nil
+}
+
+// level guesses the level of the message from its prefix, returning the
+// message without it.
+func (w *LogWriter) level(msg string) (core.Level, string) {
+	trimmed := strings.TrimLeft(msg, " ")
+
+	for _, lp := range w.opts.LevelPrefixes {
+		if len(trimmed) >= len(lp.Prefix) && strings.EqualFold(trimmed[:len(lp.Prefix)], lp.Prefix) {
+			return lp.Level, strings.TrimLeft(trimmed[len(lp.Prefix):], " ")
+		}
+	}
+
+	return *w.opts.Level, msg
+}
+
+// parseLogHeader splits a line written by a log.Logger with the given flags
+// and prefix into its time, caller and message. ok is false if the line does
+// not start with the expected header.
+func parseLogHeader(line string, flags int, prefix string) (recordedAt time.Time, caller, msg string, ok bool) {
+	rest := line
+	if flags&log.Lmsgprefix == 0 {
+		if rest, ok = strings.CutPrefix(rest, prefix); !ok {
+			return
+		}
+	}
+
+	loc := time.Local
+	if flags&log.LUTC != 0 {
+		loc = time.UTC
+	}
+
+	layout := ""
+	if flags&log.Ldate != 0 {
+		layout = "2006/01/02 "
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		layout += "15:04:05"
+		if flags&log.Lmicroseconds != 0 {
+			layout += ".000000"
+		}
+		layout += " "
+	}
+
+	recordedAt = time.Now()
+	if layout != "" {
+		if len(rest) < len(layout) {
+			return time.Time{}, "", "", false
+		}
+
+		t, err := time.ParseInLocation(layout, rest[:len(layout)], loc)
+		if err != nil {
+			return time.Time{}, "", "", false
+		}
+		rest = rest[len(layout):]
+
+		if flags&log.Ldate == 0 {
+			// Only the time of day was written
+			now := time.Now().In(loc)
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+		}
+		recordedAt = t
+	}
+
+	if flags&(log.Lshortfile|log.Llongfile) != 0 {
+		if caller, rest, ok = cutCaller(rest); !ok {
+			return time.Time{}, "", "", false
+		}
+	}
+
+	if flags&log.Lmsgprefix != 0 {
+		if rest, ok = strings.CutPrefix(rest, prefix); !ok {
+			return time.Time{}, "", "", false
+		}
+	}
+
+	return recordedAt, caller, rest, true
+}
+
+// cutCaller cuts the "file.go:23: " header from the start of s. The file
+// may contain spaces and colons, so the first ":<line>: " ends it.
+func cutCaller(s string) (caller, rest string, ok bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != ':' {
+			continue
+		}
+
+		j := i + 1
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+
+		if j > i+1 && strings.HasPrefix(s[j:], ": ") {
+			return s[:j], s[j+2:], true
+		}
+	}
+
+	return "", "", false
+}
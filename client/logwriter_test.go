@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/client/internal/clienttest"
+	"github.com/m4tth3/loggui/core"
+)
+
+func TestParseLogHeader(t *testing.T) {
+	recordedAt := time.Date(2025, 5, 1, 12, 30, 15, 123456000, time.UTC)
+
+	tests := []struct {
+		name     string
+		line     string
+		flags    int
+		prefix   string
+		time     time.Time
+		caller   string
+		msg      string
+		expected bool
+	}{
+		{"none", "hello", 0, "", time.Time{}, "", "hello", true},
+		{"std", "2025/05/01 12:30:15 hello", log.LstdFlags | log.LUTC, "", recordedAt.Truncate(time.Second), "", "hello", true},
+		{"micro", "2025/05/01 12:30:15.123456 hello", log.Ldate | log.Lmicroseconds | log.LUTC, "", recordedAt, "", "hello", true},
+		{"shortfile", "2025/05/01 12:30:15 main.go:12: hello: world", log.LstdFlags | log.Lshortfile | log.LUTC, "", recordedAt.Truncate(time.Second), "main.go:12", "hello: world", true},
+		{"longfile", "/src/my app/main.go:7: hello", log.Llongfile, "", time.Time{}, "/src/my app/main.go:7", "hello", true},
+		{"prefix", "api: 2025/05/01 12:30:15 hello", log.LstdFlags | log.LUTC, "api: ", recordedAt.Truncate(time.Second), "", "hello", true},
+		{"msgprefix", "2025/05/01 12:30:15 api: hello", log.LstdFlags | log.Lmsgprefix | log.LUTC, "api: ", recordedAt.Truncate(time.Second), "", "hello", true},
+		{"mismatch", "hello", log.LstdFlags, "", time.Time{}, "", "", false},
+		{"missing file", "hello", log.Lshortfile, "", time.Time{}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordedAt, caller, msg, ok := parseLogHeader(tt.line, tt.flags, tt.prefix)
+			if ok != tt.expected {
+				t.Fatalf("expected ok = %v, got %v", tt.expected, ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			if !tt.time.IsZero() && !recordedAt.Equal(tt.time) {
+				t.Errorf("expected time %v, got %v", tt.time, recordedAt)
+			}
+
+			if caller != tt.caller || msg != tt.msg {
+				t.Errorf("expected %q/%q, got %q/%q", tt.caller, tt.msg, caller, msg)
+			}
+		})
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := log.New(NewLogWriter(sender, &LogWriterOptions{
+		Source: "legacy",
+		Flags:  log.LstdFlags | log.Lshortfile,
+	}), "", log.LstdFlags|log.Lshortfile)
+
+	logger.Printf("[ERROR] failed to connect")
+	logger.Println("multi\nline")
+
+	if len(sender.Logs()) != 3 {
+		t.Fatalf("expected 3 logs, got %d", len(sender.Logs()))
+	}
+
+	first := sender.Logs()[0]
+	if first.Level != core.ERROR || first.IsMessageJson || first.Source == nil || *first.Source != "legacy" {
+		t.Errorf("unexpected log %+v", first)
+	}
+
+	if time.Since(first.RecordedAt) > time.Minute {
+		t.Errorf("unexpected recorded time %v", first.RecordedAt)
+	}
+
+	if first.Message != "failed to connect" || first.Attributes["caller"] == nil {
+		t.Errorf("unexpected log %q %v", first.Message, first.Attributes)
+	}
+
+	// The header is only written before the first line
+	if got := sender.Logs()[2]; got.Level != core.INFO || got.Attributes != nil || got.Message != "line" {
+		t.Errorf("unexpected log %+v", got)
+	}
+}
+
+func TestLogWriter_Partial(t *testing.T) {
+	sender := &clienttest.Sender{}
+	w := NewLogWriter(sender, nil)
+
+	_, _ = w.Write([]byte("[warning] disk "))
+	_, _ = w.Write([]byte("almost full\nstill "))
+	if len(sender.Logs()) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(sender.Logs()))
+	}
+
+	if got := sender.Logs()[0]; got.Level != core.WARN || got.Message != "disk almost full" {
+		t.Errorf("unexpected log %+v", got)
+	}
+
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if len(sender.Logs()) != 2 || sender.Logs()[1].Message != "still " || sender.Flushed() != 1 {
+		t.Errorf("expected the partial line to be flushed, got %d logs", len(sender.Logs()))
+	}
+}
+
+// failingSender accepts remaining logs, then fails every Send
+type failingSender struct {
+	clienttest.Sender
+	remaining int
+}
+
+func (s *failingSender) Send(log *core.Log) error {
+	if s.remaining <= 0 {
+		return errors.New("queue is full")
+	}
+
+	s.remaining--
+	return s.Sender.Send(log)
+}
+
+func TestLogWriter_SendFails(t *testing.T) {
+	sender := &failingSender{remaining: 2}
+	w := NewLogWriter(sender, nil)
+
+	_, _ = w.Write([]byte("one\ntw"))
+
+	// "one" was sent before, and "two" is sent before the failure
+	p := []byte("o\nthree\nfour\n")
+	n, err := w.Write(p)
+	if err == nil || n != len("o\n") {
+		t.Fatalf("expected %d bytes written and an error, got %d %v", len("o\n"), n, err)
+	}
+
+	// The rest can be written again once the sender accepts it
+	sender.remaining = 2
+	if n, err := w.Write(p[n:]); err != nil || n != len(p)-len("o\n") {
+		t.Fatalf("expected the rest to be written, got %d %v", n, err)
+	}
+
+	var got []string
+	for _, log := range sender.Logs() {
+		got = append(got, log.Message)
+	}
+
+	if strings.Join(got, ",") != "one,two,three,four" {
+		t.Errorf("expected every line once, got %v", got)
+	}
+}
+
+func TestLogWriter_SendFailsHeld(t *testing.T) {
+	sender := &failingSender{}
+	w := NewLogWriter(sender, nil)
+
+	// A line held from an earlier write is kept when it cannot be sent
+	_, _ = w.Write([]byte("par"))
+	if n, err := w.Write([]byte("tial\n")); err == nil || n != 0 {
+		t.Fatalf("expected nothing written and an error, got %d %v", n, err)
+	}
+
+	sender.remaining = 1
+	if _, err := w.Write([]byte("tial\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if got := sender.Logs(); len(got) != 1 || got[0].Message != "partial" {
+		t.Errorf("expected the held line to be kept, got %v", got)
+	}
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultRequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength bounds the request IDs taken from clients
+	maxRequestIDLength = 128
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+	traceContextKey
+)
+
+// MiddlewareOptions configures the request logging middleware.
+type MiddlewareOptions struct {
+	// Level is the minimum level sent by the request loggers. Defaults to
+	// slog.LevelInfo.
+	Level slog.Leveler
+
+	Source string
+
+	// Header carries the request ID. An ID sent by the client is kept and
+	// the ID is always echoed in the response. Defaults to X-Request-ID.
+	Header string
+
+	// NewID generates the ID of requests which do not carry one. Defaults
+	// to 16 random bytes in hex.
+	NewID func() string
+}
+
+// Middleware returns http.Handler middleware which gives every request a
+// logger with its Group set to the request ID, so all of the logs of a
+// request can be viewed together. The logger is read back with Logger.
+//
+// Each request is served in a new span of the trace in its W3C traceparent
+// header, or of a new trace if it has none, and its logs carry the trace
+// and span IDs. The trace context is read back with TraceFromContext, and
+// Transport propagates it to the requests made while serving.
+//
+// A summary log with the method, path, status, bytes and latency is sent
+// when the request finishes, at WARN for 4xx and ERROR for 5xx statuses.
+func Middleware(sender Sender, opts *MiddlewareOptions) func(http.Handler) http.Handler {
+	var o MiddlewareOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Header == "" {
+		o.Header = DefaultRequestIDHeader
+	}
+
+	if o.NewID == nil {
+		o.NewID = func() string { return randomHex(16) }
+	}
+
+	handler := NewSlogHandler(sender, &SlogOptions{Level: o.Level, Source: o.Source})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(o.Header)
+			if !validRequestID(id) {
+				id = o.NewID()
+			}
+			w.Header().Set(o.Header, id)
+
+			tc := traceFromRequest(r)
+			logger := slog.New(handler.withGroupID(id).withTrace(tc))
+
+			ctx := context.WithValue(r.Context(), loggerKey, logger)
+			ctx = context.WithValue(ctx, requestIDKey, id)
+			ctx = ContextWithTrace(ctx, tc)
+
+			rw := &responseWriter{ResponseWriter: w}
+
+			defer func() {
+				// A panic is logged as a 500 and passed on to the server
+				p := recover()
+				if p != nil && !rw.wroteHeader {
+					rw.status = http.StatusInternalServerError
+				}
+
+				logRequest(ctx, logger, r, rw, time.Since(start))
+
+				if p != nil {
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+// Logger returns the request logger stored in the context by Middleware,
+// or slog.Default() if there is none.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// RequestID returns the request ID stored in the context by Middleware, or
+// an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func logRequest(ctx context.Context, logger *slog.Logger, r *http.Request, rw *responseWriter, latency time.Duration) {
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	}
+
+	logger.LogAttrs(ctx, level, "request completed",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", status),
+		slog.Int64("bytes", rw.bytes),
+		slog.Duration("latency", latency),
+	)
+}
+
+// randomHex returns n random bytes, hex encoded. It is used for request,
+// trace and span IDs.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID only accepts IDs made of printable ASCII, so a client
+// cannot inject anything odd into the Group.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// responseWriter records the status and number of bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+		w.wroteHeader = true
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher for streaming handlers.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.status = http.StatusOK
+			w.wroteHeader = true
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for websocket handlers.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("response writer does not implement http.Hijacker")
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
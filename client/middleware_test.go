@@ -0,0 +1,103 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m4tth3/loggui/client/internal/clienttest"
+	"github.com/m4tth3/loggui/core"
+)
+
+func TestMiddleware(t *testing.T) {
+	sender := &clienttest.Sender{}
+	handler := Middleware(sender, &MiddlewareOptions{Source: "api"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Logger(r.Context()).Info("handling", "user", 7)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("missing"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+
+	id := rec.Header().Get(DefaultRequestIDHeader)
+	if len(id) != 32 {
+		t.Fatalf("expected a generated request ID, got %q", id)
+	}
+
+	if len(sender.Logs()) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(sender.Logs()))
+	}
+
+	for _, log := range sender.Logs() {
+		if log.Group == nil || *log.Group != id || log.Source == nil || *log.Source != "api" {
+			t.Errorf("expected log in group %q, got %+v", id, log)
+		}
+	}
+
+	summary := sender.Logs()[1]
+	if summary.Level != core.WARN {
+		t.Errorf("expected a 404 to be logged at WARN, got %v", summary.Level)
+	}
+
+	m := clienttest.DecodeAttributes(t, summary)
+	if summary.Message != "request completed" || m["method"] != "GET" || m["path"] != "/users/7" || m["status"] != float64(404) || m["bytes"] != float64(7) || m["latency"] == nil {
+		t.Errorf("unexpected summary %v", m)
+	}
+}
+
+func TestMiddleware_PropagatesID(t *testing.T) {
+	sender := &clienttest.Sender{}
+
+	var got string
+	handler := Middleware(sender, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		expected bool
+	}{
+		{"valid", "abc-123", true},
+		{"invalid", "abc 123", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(DefaultRequestIDHeader, tt.header)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if (got == tt.header) != tt.expected {
+				t.Errorf("request ID %q, header %q", got, tt.header)
+			}
+
+			if rec.Header().Get(DefaultRequestIDHeader) != got {
+				t.Errorf("expected the request ID to be echoed")
+			}
+		})
+	}
+}
+
+func TestMiddleware_Panic(t *testing.T) {
+	sender := &clienttest.Sender{}
+	handler := Middleware(sender, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected the panic to be passed on")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	if len(sender.Logs()) != 1 || sender.Logs()[0].Level != core.ERROR {
+		t.Errorf("expected an ERROR summary, got %+v", sender.Logs())
+	}
+}
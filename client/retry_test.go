@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.retry, 100*time.Millisecond, time.Second, 0); got != tt.expected {
+			t.Errorf("backoff(%d) = %v, want %v", tt.retry, got, tt.expected)
+		}
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	for range 100 {
+		got := backoff(3, 100*time.Millisecond, time.Second, 0.5)
+		if got < 200*time.Millisecond || got > 400*time.Millisecond {
+			t.Fatalf("backoff with jitter = %v, want within [200ms, 400ms]", got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second},
+		{now.Add(-5 * time.Second).Format(http.TimeFormat), 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.expected {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.expected)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if !b.allow() {
+		t.Fatalf("breaker opened before reaching the threshold")
+	}
+
+	b.failure()
+	if state, trips := b.stats(); state != BreakerOpen || trips != 1 {
+		t.Fatalf("expected open breaker with 1 trip, got %v with %d", state, trips)
+	}
+
+	if b.allow() {
+		t.Fatalf("open breaker let a request through")
+	}
+
+	// After the cooldown a single probe is allowed
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatalf("breaker did not probe after the cooldown")
+	}
+
+	if b.allow() {
+		t.Fatalf("half-open breaker let a second request through")
+	}
+
+	// A failed probe opens the breaker again
+	b.failure()
+	if state, trips := b.stats(); state != BreakerOpen || trips != 2 {
+		t.Fatalf("expected open breaker with 2 trips, got %v with %d", state, trips)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatalf("breaker did not probe after the cooldown")
+	}
+
+	b.success()
+	if state, _ := b.stats(); state != BreakerClosed || !b.allow() {
+		t.Fatalf("expected closed breaker after a successful probe, got %v", state)
+	}
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	var first time.Time
+	var second time.Time
+
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int {
+		if srv.requests.Load() == 1 {
+			first = time.Now()
+			return http.StatusTooManyRequests
+		}
+		second = time.Now()
+		return http.StatusOK
+	}
+
+	// Wrap the handler so the first response carries a Retry-After
+	handler := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		handler.ServeHTTP(w, r)
+	})
+
+	c := newTestClient(t, Config{URL: srv.URL, MinBackoff: time.Millisecond})
+	_ = c.Send(testLog("a"))
+
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if second.Sub(first) < time.Second {
+		t.Errorf("retry was sent after %v, before Retry-After elapsed", second.Sub(first))
+	}
+}
+
+func TestClient_BreakerOpens(t *testing.T) {
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int { return http.StatusServiceUnavailable }
+
+	c := newTestClient(t, Config{
+		URL:              srv.URL,
+		MaxRetries:       -1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+
+	for range 2 {
+		_ = c.Send(testLog("a"))
+		_ = c.Flush(context.Background())
+	}
+
+	_ = c.Send(testLog("a"))
+	if err := c.Flush(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	got := c.Stats()
+	if got.Breaker != BreakerOpen || got.BreakerTrips != 1 || got.Dropped != 3 {
+		t.Errorf("unexpected stats %+v", got)
+	}
+
+	if srv.requests.Load() != 2 {
+		t.Errorf("expected no request while the breaker is open, got %d requests", srv.requests.Load())
+	}
+}
+
+func TestClient_RetryAfterCapped(t *testing.T) {
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int {
+		if srv.requests.Load() == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+
+	// An hour long Retry-After must not stall the client past MaxBackoff
+	handler := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		handler.ServeHTTP(w, r)
+	})
+
+	c := newTestClient(t, Config{URL: srv.URL, MinBackoff: time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	_ = c.Send(testLog("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if got := c.Stats(); got.Sent != 1 || got.Retried != 1 {
+		t.Errorf("unexpected stats %+v", got)
+	}
+}
+
+func TestClient_CloseStopsRetryWait(t *testing.T) {
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int { return http.StatusServiceUnavailable }
+
+	c := newTestClient(t, Config{URL: srv.URL, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	_ = c.Send(testLog("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := c.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the close to time out, got %v", err)
+	}
+
+	// The drain left in the background gives up waiting once Close returns
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the run loop is still waiting to retry")
+	}
+
+	if got := c.Stats(); got.Dropped != 1 {
+		t.Errorf("expected the log to be dropped, got %+v", got)
+	}
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+const ingestPath = "/api/v1/logs"
+
+// ingestResponse is the part of the server's ingest response the client
+// cares about.
+type ingestResponse struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+// statusError is returned when the server responds with a non 2xx status.
+// retryAfter is set from the Retry-After header of a 429 or 503.
+type statusError struct {
+	status     int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server responded with %d: %s", e.status, e.body)
+}
+
+// retryable reports whether sending the same batch again could succeed.
+func (e *statusError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// httpSender POSTs gzip compressed batches to the server's ingest endpoint
+// and updates the client's counters with the outcome.
+type httpSender struct {
+	client   *Client
+	endpoint string
+}
+
+func newHTTPSender(c *Client) (*httpSender, error) {
+	endpoint, err := url.JoinPath(c.config.URL, ingestPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	return &httpSender{
+		client:   c,
+		endpoint: endpoint,
+	}, nil
+}
+
+// send delivers the batch. If it cannot be delivered and a spool is
+// configured, the batch is written to the spool instead. Logs that are
+// neither delivered nor spooled are counted as dropped.
+func (s *httpSender) send(ctx context.Context, batch []*core.Log) error {
+	body, err := encodeBatch(batch)
+	if err != nil {
+		s.client.dropped.Add(uint64(len(batch)))
+		return err
+	}
+
+	// Older batches are still waiting in the spool, so queue up behind
+	// them to keep the logs in order.
+	if s.client.spool != nil && s.client.spool.pending() {
+		if err := s.toSpool(body, len(batch)); err != nil {
+			return err
+		}
+
+		return s.replay(ctx)
+	}
+
+	err = s.deliver(ctx, body)
+	if err == nil {
+		return nil
+	}
+
+	var statusErr *statusError
+	rejected := errors.As(err, &statusErr) && !statusErr.retryable()
+
+	if !rejected && s.client.spool != nil {
+		return s.toSpool(body, len(batch))
+	}
+
+	s.client.dropped.Add(uint64(len(batch)))
+	return err
+}
+
+// deliver posts the body, retrying failures that may be temporary with an
+// exponential backoff, until it succeeds, the retries run out or the
+// circuit breaker opens.
+func (s *httpSender) deliver(ctx context.Context, body []byte) error {
+	config := s.client.config
+	for attempt := 0; ; attempt++ {
+		if !s.client.breaker.allow() {
+			return ErrCircuitOpen
+		}
+
+		resp, err := s.post(ctx, body)
+		if err == nil {
+			s.client.breaker.success()
+			s.client.sent.Add(uint64(resp.Accepted))
+			s.client.dropped.Add(uint64(resp.Rejected))
+			return nil
+		}
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			// The server is up, it just won't take this batch
+			s.client.breaker.success()
+			return err
+		}
+
+		s.client.breaker.failure()
+		if attempt >= config.MaxRetries {
+			return err
+		}
+
+		delay := backoff(attempt+1, config.MinBackoff, config.MaxBackoff, config.Jitter)
+		if statusErr != nil && statusErr.retryAfter > 0 {
+			delay = min(statusErr.retryAfter, config.MaxBackoff)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.client.stopped:
+			return err
+		}
+
+		s.client.retried.Add(1)
+	}
+}
+
+// replay sends the spooled batches in order. It stops without an error at
+// the first batch that fails, as the spool keeps it for the next attempt.
+// Only errors reading or writing the spool are returned.
+func (s *httpSender) replay(ctx context.Context) error {
+	if s.client.spool == nil {
+		return nil
+	}
+
+	for {
+		rec, err := s.client.spool.peek()
+		if errors.Is(err, errSpoolEmpty) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !s.client.breaker.allow() {
+			return nil
+		}
+
+		var statusErr *statusError
+		resp, err := s.post(ctx, rec.body)
+		switch {
+		case err == nil:
+			s.client.breaker.success()
+			s.client.sent.Add(uint64(resp.Accepted))
+			s.client.dropped.Add(uint64(resp.Rejected))
+		case errors.As(err, &statusErr) && !statusErr.retryable():
+			s.client.breaker.success()
+			s.client.dropped.Add(uint64(rec.count))
+		default:
+			s.client.breaker.failure()
+			return nil
+		}
+
+		if err := s.client.spool.commit(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *httpSender) toSpool(body []byte, count int) error {
+	if err := s.client.spool.append(body, count); err != nil {
+		s.client.dropped.Add(uint64(count))
+		return err
+	}
+
+	s.client.spooled.Add(uint64(count))
+	return nil
+}
+
+func (s *httpSender) post(ctx context.Context, body []byte) (*ingestResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	config := s.client.config
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	} else if config.Username != "" || config.Password != "" {
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+
+	resp, err := config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		statusErr := &statusError{status: resp.StatusCode, body: string(bytes.TrimSpace(msg))}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			statusErr.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+
+		return nil, statusErr
+	}
+
+	out := &ingestResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	return out, nil
+}
+
+// encodeBatch encodes the batch as a gzip compressed JSON array.
+func encodeBatch(batch []*core.Log) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+
+	if err := json.NewEncoder(zw).Encode(batch); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,283 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+// SlogOptions configures a SlogHandler.
+//
+// Source and Group are used for every log unless a record has an attribute
+// named SourceKey or GroupKey, whose value is used instead. Those attributes
+// are not rendered into the message.
+type SlogOptions struct {
+	// Level is the minimum level that is sent. Defaults to slog.LevelInfo.
+	Level slog.Leveler
+
+	Source string
+	Group  string
+
+	SourceKey string
+	GroupKey  string
+}
+
+// SlogHandler is a slog.Handler that sends records through a Sender. The
+// record attributes become the log's Attributes, with groups as nested
+// objects, e.g.
+//
+//	{"status": 200, "req": {"path": "/"}}
+//
+// Implements slog.Handler
+type SlogHandler struct {
+	sender Sender
+	opts   SlogOptions
+
+	// attrs holds the attributes added by WithAttrs, nested under groups
+	attrs  map[string]any
+	groups []string
+
+	source *string
+	group  *string
+
+	// trace is bound by Middleware, and used for records whose context
+	// has no trace of its own
+	trace *TraceContext
+}
+
+func NewSlogHandler(sender Sender, opts *SlogOptions) *SlogHandler {
+	h := &SlogHandler{
+		sender: sender,
+		attrs:  map[string]any{},
+	}
+
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+
+	if h.opts.Source != "" {
+		h.source = &h.opts.Source
+	}
+
+	if h.opts.Group != "" {
+		h.group = &h.opts.Group
+	}
+
+	return h
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	source, group := h.source, h.group
+	attrs := cloneAttrs(h.attrs)
+	target := groupMap(attrs, h.groups)
+
+	r.Attrs(func(a slog.Attr) bool {
+		h.addAttr(target, a, &source, &group)
+		return true
+	})
+
+	// Groups without any attributes are left out, as slog's own handlers do
+	pruneGroups(attrs)
+
+	attributes, err := EncodeAttributes(attrs)
+	if err != nil {
+		return err
+	}
+
+	recordedAt := r.Time
+	if recordedAt.IsZero() {
+		recordedAt = time.Now()
+	}
+
+	log := &core.Log{
+		Level:      slogLevel(r.Level),
+		Source:     source,
+		Group:      group,
+		Message:    r.Message,
+		RecordedAt: recordedAt,
+		Attributes: attributes,
+	}
+
+	trace := h.trace
+	if tc, ok := TraceFromContext(ctx); ok {
+		trace = &tc
+	}
+
+	if trace != nil {
+		traceID, spanID := trace.TraceID, trace.SpanID
+		log.TraceID, log.SpanID = &traceID, &spanID
+	}
+
+	return h.sender.Send(log)
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := *h
+	h2.attrs = cloneAttrs(h.attrs)
+	target := groupMap(h2.attrs, h2.groups)
+
+	for _, a := range attrs {
+		h2.addAttr(target, a, &h2.source, &h2.group)
+	}
+
+	return &h2
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// withGroupID returns a handler whose logs are sent with the given Group.
+func (h *SlogHandler) withGroupID(group string) *SlogHandler {
+	h2 := *h
+	h2.group = &group
+	return &h2
+}
+
+// withTrace returns a handler whose logs carry the trace context, unless
+// the context they are logged with has its own.
+func (h *SlogHandler) withTrace(tc TraceContext) *SlogHandler {
+	h2 := *h
+	h2.trace = &tc
+	return &h2
+}
+
+// addAttr renders the attribute into target. The source and group keys are
+// only picked up outside of any group.
+func (h *SlogHandler) addAttr(target map[string]any, a slog.Attr, source, group **string) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if len(h.groups) == 0 && a.Value.Kind() == slog.KindString {
+		switch {
+		case h.opts.SourceKey != "" && a.Key == h.opts.SourceKey:
+			value := a.Value.String()
+			*source = &value
+			return
+		case h.opts.GroupKey != "" && a.Key == h.opts.GroupKey:
+			value := a.Value.String()
+			*group = &value
+			return
+		}
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+
+		// Groups without a key are inlined
+		nested := target
+		if a.Key != "" {
+			nested = groupMap(target, []string{a.Key})
+		}
+
+		for _, ga := range attrs {
+			h.addAttr(nested, ga, source, group)
+		}
+		return
+	}
+
+	target[a.Key] = slogValue(a.Value)
+}
+
+// slogValue converts the value into something encoding/json renders well.
+func slogValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+
+		return v.Any()
+	default:
+		return v.Any()
+	}
+}
+
+// slogLevel maps a slog level onto the closest core.Level. Levels between
+// the named slog levels round down.
+func slogLevel(l slog.Level) core.Level {
+	switch {
+	case l < slog.LevelDebug:
+		return core.TRACE
+	case l < slog.LevelInfo:
+		return core.DEBUG
+	case l < slog.LevelWarn:
+		return core.INFO
+	case l < slog.LevelError:
+		return core.WARN
+	case l < slog.LevelError+4:
+		return core.ERROR
+	default:
+		return core.FATAL
+	}
+}
+
+// groupMap returns the map nested under the path of groups, creating any
+// that are missing.
+func groupMap(m map[string]any, groups []string) map[string]any {
+	for _, g := range groups {
+		nested, ok := m[g].(map[string]any)
+		if !ok {
+			nested = map[string]any{}
+			m[g] = nested
+		}
+		m = nested
+	}
+
+	return m
+}
+
+// pruneGroups removes the nested group maps which are empty, and reports
+// whether m is then empty itself.
+func pruneGroups(m map[string]any) bool {
+	for k, v := range m {
+		if nested, ok := v.(map[string]any); ok && pruneGroups(nested) {
+			delete(m, k)
+		}
+	}
+
+	return len(m) == 0
+}
+
+// cloneAttrs deep copies the nested group maps so that handlers created
+// with WithAttrs do not share them.
+func cloneAttrs(m map[string]any) map[string]any {
+	out := maps.Clone(m)
+	for k, v := range out {
+		if nested, ok := v.(map[string]any); ok {
+			out[k] = cloneAttrs(nested)
+		}
+	}
+
+	return out
+}
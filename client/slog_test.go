@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/client/internal/clienttest"
+	"github.com/m4tth3/loggui/core"
+)
+
+func TestSlogHandler_Levels(t *testing.T) {
+	tests := []struct {
+		level    slog.Level
+		expected core.Level
+	}{
+		{slog.LevelDebug - 4, core.TRACE},
+		{slog.LevelDebug, core.DEBUG},
+		{slog.LevelInfo, core.INFO},
+		{slog.LevelInfo + 2, core.INFO},
+		{slog.LevelWarn, core.WARN},
+		{slog.LevelError, core.ERROR},
+		{slog.LevelError + 4, core.FATAL},
+	}
+
+	for _, tt := range tests {
+		if got := slogLevel(tt.level); got != tt.expected {
+			t.Errorf("slogLevel(%v) = %v, want %v", tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestSlogHandler_Enabled(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := slog.New(NewSlogHandler(sender, &SlogOptions{Level: slog.LevelWarn}))
+
+	logger.Info("ignored")
+	logger.Warn("sent")
+
+	if len(sender.Logs()) != 1 || sender.Last(t).Level != core.WARN {
+		t.Errorf("expected a single warn log, got %d logs", len(sender.Logs()))
+	}
+}
+
+func TestSlogHandler_Attrs(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := slog.New(NewSlogHandler(sender, &SlogOptions{
+		Source:    "default-source",
+		SourceKey: "service",
+		GroupKey:  "request_id",
+	}))
+
+	logger = logger.With("service", "api", "version", 2).WithGroup("req")
+	logger.Error("failed", "path", "/", slog.Group("user", "id", 7), "err", errors.New("boom"))
+
+	log := sender.Last(t)
+	if log.Level != core.ERROR {
+		t.Errorf("expected error level, got %v", log.Level)
+	}
+
+	if log.Source == nil || *log.Source != "api" {
+		t.Errorf("expected source from the service attribute, got %v", log.Source)
+	}
+
+	if log.Group != nil {
+		t.Errorf("expected no group, got %v", *log.Group)
+	}
+
+	m := clienttest.DecodeAttributes(t, log)
+	if log.Message != "failed" || m["version"] != float64(2) {
+		t.Errorf("unexpected log %q %v", log.Message, m)
+	}
+
+	if _, ok := m["service"]; ok {
+		t.Errorf("source attribute should not be kept, got %v", m)
+	}
+
+	req, _ := m["req"].(map[string]any)
+	user, _ := req["user"].(map[string]any)
+	if req["path"] != "/" || req["err"] != "boom" || user["id"] != float64(7) {
+		t.Errorf("unexpected group rendering %v", m)
+	}
+}
+
+func TestSlogHandler_WithAttrsIsolated(t *testing.T) {
+	sender := &clienttest.Sender{}
+	base := slog.New(NewSlogHandler(sender, &SlogOptions{GroupKey: "request_id"}))
+
+	a := base.With("request_id", "a").WithGroup("g").With("k", "a")
+	b := base.With("request_id", "b").WithGroup("g").With("k", "b")
+
+	a.Info("from a")
+	logA := sender.Last(t)
+	b.Info("from b")
+	logB := sender.Last(t)
+
+	if *logA.Group != "a" || *logB.Group != "b" {
+		t.Errorf("expected groups a and b, got %s and %s", *logA.Group, *logB.Group)
+	}
+
+	if g := clienttest.DecodeAttributes(t, logA)["g"].(map[string]any); g["k"] != "a" {
+		t.Errorf("handlers share attributes: %v", g)
+	}
+}
+
+func TestSlogHandler_NoAttrs(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := slog.New(NewSlogHandler(sender, nil)).WithGroup("req")
+
+	logger.Info("plain")
+	if log := sender.Last(t); log.Message != "plain" || log.Attributes != nil {
+		t.Errorf("expected no attributes, got %v", log.Attributes)
+	}
+
+	logger.Info("grouped", slog.Group("empty"), "k", "v")
+	if m := clienttest.DecodeAttributes(t, sender.Last(t)); len(m) != 1 || m["req"].(map[string]any)["k"] != "v" {
+		t.Errorf("expected only req.k, got %v", m)
+	}
+}
+
+func TestSlogHandler_InvalidAttr(t *testing.T) {
+	sender := &clienttest.Sender{}
+	handler := NewSlogHandler(sender, nil)
+
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, "bad", 0)
+	r.AddAttrs(slog.Any("f", func() {}))
+
+	if err := handler.Handle(context.Background(), r); err == nil {
+		t.Error("expected an attribute which cannot be encoded to fail")
+	}
+
+	if len(sender.Logs()) != 0 {
+		t.Errorf("expected nothing to be sent, got %d logs", len(sender.Logs()))
+	}
+}
@@ -0,0 +1,526 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The spool is a directory of append-only segment files holding batches
+// that could not be delivered. Each record is
+//
+//	magic (4) | length (4) | crc32 (4) | count (4) | body (length)
+//
+// where body is the encoded batch as it would be POSTed, count is the
+// number of logs in it, and the crc32 covers length, count and body. A
+// length longer than the rest of the segment is corrupt, so a damaged
+// header is never trusted to size a read, and magic marks where records
+// start so that those after a corrupt one can still be found and replayed. The position
+// of the next record to replay is kept in the offset file, which is
+// replaced atomically so a crash never replays from a torn offset.
+
+const (
+	DefaultSpoolMaxBytes = 1 << 30
+	DefaultSpoolMaxAge   = 7 * 24 * time.Hour
+
+	spoolSegmentSize = 16 << 20
+	spoolSegmentExt  = ".seg"
+	spoolOffsetFile  = "offset"
+	spoolHeaderSize  = 16
+)
+
+// spoolMagic starts every record
+var spoolMagic = []byte{'l', 'g', 's', 'p'}
+
+var errSpoolEmpty = errors.New("spool is empty")
+
+// spoolRecord is a batch read from the spool. seg and next locate the end
+// of the record so it can be committed once delivered.
+type spoolRecord struct {
+	body  []byte
+	count int
+
+	seg  uint64
+	next int64
+}
+
+type spool struct {
+	dir         string
+	maxBytes    int64
+	maxAge      time.Duration
+	segmentSize int64
+
+	mutex sync.Mutex
+
+	// The segment currently appended to. It is created on the first append
+	// after opening, so segments written before a crash are never reopened.
+	writer    *os.File
+	writeSeg  uint64
+	writeSize int64
+
+	readSeg uint64
+	readOff int64
+
+	// dropped is called with the number of logs discarded by the size and
+	// age limits. corrupted is called for every record that fails its
+	// checksum or is truncated.
+	dropped   func(count int)
+	corrupted func()
+}
+
+func openSpool(dir string, maxBytes int64, maxAge time.Duration) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		dir:         dir,
+		maxBytes:    maxBytes,
+		maxAge:      maxAge,
+		segmentSize: min(spoolSegmentSize, max(maxBytes/4, 1)),
+		dropped:     func(int) {},
+		corrupted:   func() {},
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	offSeg, offOff, err := s.loadOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(segments) == 0 {
+		s.writeSeg = max(offSeg, 1)
+		s.readSeg = s.writeSeg
+		return s, nil
+	}
+
+	s.writeSeg = segments[len(segments)-1] + 1
+	s.readSeg = segments[0]
+	switch {
+	case offSeg >= s.writeSeg:
+		s.readSeg = s.writeSeg
+	case offSeg >= s.readSeg:
+		s.readSeg = offSeg
+		s.readOff = offOff
+	}
+
+	// Segments before the read offset have been fully replayed
+	for _, seg := range segments {
+		if seg < s.readSeg {
+			_ = os.Remove(s.path(seg))
+		}
+	}
+
+	return s, nil
+}
+
+// append durably writes the batch to the end of the spool.
+func (s *spool) append(body []byte, count int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.writer == nil || s.writeSize >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, spoolHeaderSize+len(body))
+	copy(record[0:4], spoolMagic)
+	binary.BigEndian.PutUint32(record[4:8], uint32(len(body)))
+	binary.BigEndian.PutUint32(record[12:16], uint32(count))
+	copy(record[spoolHeaderSize:], body)
+	binary.BigEndian.PutUint32(record[8:12], recordChecksum(record[4:8], record[12:]))
+
+	if _, err := s.writer.Write(record); err != nil {
+		return err
+	}
+
+	if err := s.writer.Sync(); err != nil {
+		return err
+	}
+
+	s.writeSize += int64(len(record))
+	s.enforceLimits()
+
+	return nil
+}
+
+// trim applies the size and age limits without appending.
+func (s *spool) trim() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.enforceLimits()
+}
+
+// pending reports whether there may be records left to replay.
+func (s *spool) pending() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.readSeg < s.writeSeg {
+		return true
+	}
+
+	return s.writer != nil && s.readOff < s.writeSize
+}
+
+// peek returns the oldest record without removing it. A corrupt record is
+// skipped by resyncing to the next intact record in its segment.
+func (s *spool) peek() (*spoolRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		if s.readSeg > s.writeSeg || (s.readSeg == s.writeSeg && s.writer == nil) {
+			return nil, errSpoolEmpty
+		}
+
+		rec, err := s.readRecord(s.readSeg, s.readOff)
+		switch {
+		case err == nil:
+			return rec, nil
+		case errors.Is(err, io.EOF) || errors.Is(err, os.ErrNotExist):
+			// Clean end of the segment
+		case errors.Is(err, errCorruptRecord):
+			s.corrupted()
+			if next, ok := s.resync(s.readSeg, s.readOff); ok {
+				s.readOff = next
+				if err := s.saveOffset(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		default:
+			return nil, err
+		}
+
+		if s.readSeg == s.writeSeg {
+			if errors.Is(err, errCorruptRecord) {
+				// Nothing intact follows in what was written so far to
+				// the active segment
+				s.readOff = s.writeSize
+				_ = s.saveOffset()
+			}
+
+			return nil, errSpoolEmpty
+		}
+
+		_ = os.Remove(s.path(s.readSeg))
+		s.readSeg++
+		s.readOff = 0
+		if err := s.saveOffset(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// commit removes a record returned by peek from the spool.
+func (s *spool) commit(rec *spoolRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if rec.seg != s.readSeg {
+		// The segment was removed by the limits in the meantime
+		return nil
+	}
+
+	s.readOff = rec.next
+	return s.saveOffset()
+}
+
+func (s *spool) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.writer == nil {
+		return nil
+	}
+
+	err := s.writer.Close()
+	s.writer = nil
+	s.writeSeg++
+	s.writeSize = 0
+	return err
+}
+
+var errCorruptRecord = errors.New("corrupt spool record")
+
+func (s *spool) readRecord(seg uint64, off int64) (*spoolRecord, error) {
+	f, err := os.Open(s.path(seg))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, spoolHeaderSize)
+	n, err := f.ReadAt(header, off)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	} else if n < spoolHeaderSize || !bytes.Equal(header[0:4], spoolMagic) {
+		return nil, errCorruptRecord
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[4:8]))
+	sum := binary.BigEndian.Uint32(header[8:12])
+
+	// The length is checked before it sizes the body, as a damaged one
+	// could ask for gigabytes
+	if length > info.Size()-off-spoolHeaderSize {
+		return nil, errCorruptRecord
+	}
+
+	body := make([]byte, length)
+	if n, _ := f.ReadAt(body, off+spoolHeaderSize); n < len(body) {
+		return nil, errCorruptRecord
+	}
+
+	if recordChecksum(header[4:8], header[12:16], body) != sum {
+		return nil, errCorruptRecord
+	}
+
+	return &spoolRecord{
+		body:  body,
+		count: int(binary.BigEndian.Uint32(header[12:16])),
+		seg:   seg,
+		next:  off + spoolHeaderSize + length,
+	}, nil
+}
+
+// recordChecksum returns the crc32 of the parts of a record it covers
+func recordChecksum(parts ...[]byte) uint32 {
+	crc := crc32.NewIEEE()
+	for _, part := range parts {
+		crc.Write(part)
+	}
+
+	return crc.Sum32()
+}
+
+// resync returns the offset of the first intact record after the corrupt
+// one at off. The corrupt header cannot say where the next record starts,
+// so it is found by its magic.
+func (s *spool) resync(seg uint64, off int64) (int64, bool) {
+	f, err := os.Open(s.path(seg))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	// Reading the segment once keeps the search linear. It is at most
+	// segmentSize and the record which went over it.
+	info, err := f.Stat()
+	if err != nil || off+1 >= info.Size() {
+		return 0, false
+	}
+
+	raw := make([]byte, info.Size()-off-1)
+	if _, err := f.ReadAt(raw, off+1); err != nil {
+		return 0, false
+	}
+
+	for skipped := 0; len(raw) >= spoolHeaderSize; {
+		i := bytes.Index(raw, spoolMagic)
+		if i < 0 || len(raw)-i < spoolHeaderSize {
+			break
+		}
+
+		header := raw[i : i+spoolHeaderSize]
+		length := int64(binary.BigEndian.Uint32(header[4:8]))
+		end := int64(i + spoolHeaderSize)
+		if length <= int64(len(raw))-end && recordChecksum(header[4:8], header[12:16], raw[end:end+length]) == binary.BigEndian.Uint32(header[8:12]) {
+			return off + 1 + int64(skipped+i), true
+		}
+
+		skipped += i + 1
+		raw = raw[i+1:]
+	}
+
+	return 0, false
+}
+
+func (s *spool) rotate() error {
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return err
+		}
+		s.writeSeg++
+	}
+
+	f, err := os.OpenFile(s.path(s.writeSeg), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		s.writer = nil
+		return err
+	}
+
+	s.writer = f
+	s.writeSize = 0
+	return nil
+}
+
+// enforceLimits removes the oldest segments while the spool is over
+// maxBytes, and any segment last written to more than maxAge ago. The
+// active segment is never removed.
+func (s *spool) enforceLimits() {
+	segments, err := s.segments()
+	if err != nil {
+		return
+	}
+
+	var total int64
+	infos := make(map[uint64]os.FileInfo, len(segments))
+	for _, seg := range segments {
+		if info, err := os.Stat(s.path(seg)); err == nil {
+			infos[seg] = info
+			total += info.Size()
+		}
+	}
+
+	cutoff := time.Now().Add(-s.maxAge)
+	for _, seg := range segments {
+		info, ok := infos[seg]
+		if !ok || seg == s.writeSeg {
+			continue
+		}
+
+		if total <= s.maxBytes && info.ModTime().After(cutoff) {
+			break
+		}
+
+		s.dropSegment(seg)
+		total -= info.Size()
+	}
+}
+
+// dropSegment removes a segment that has not been fully replayed, counting
+// its remaining logs as dropped.
+func (s *spool) dropSegment(seg uint64) {
+	if seg < s.readSeg {
+		_ = os.Remove(s.path(seg))
+		return
+	}
+
+	var off int64
+	if seg == s.readSeg {
+		off = s.readOff
+	}
+
+	for count := 0; ; {
+		rec, err := s.readRecord(seg, off)
+		if errors.Is(err, errCorruptRecord) {
+			if next, ok := s.resync(seg, off); ok {
+				off = next
+				continue
+			}
+		}
+
+		if err != nil {
+			s.dropped(count)
+			break
+		}
+
+		count += rec.count
+		off = rec.next
+	}
+
+	_ = os.Remove(s.path(seg))
+
+	s.readSeg = seg + 1
+	s.readOff = 0
+	_ = s.saveOffset()
+}
+
+// segments returns the segment numbers in the spool in ascending order.
+func (s *spool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), spoolSegmentExt)
+		if !ok {
+			continue
+		}
+
+		if seg, err := strconv.ParseUint(name, 10, 64); err == nil {
+			segments = append(segments, seg)
+		}
+	}
+
+	slices.Sort(segments)
+	return segments, nil
+}
+
+func (s *spool) path(seg uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seg, spoolSegmentExt))
+}
+
+// loadOffset returns the read position saved by saveOffset, or zeros if
+// there is none.
+func (s *spool) loadOffset() (uint64, int64, error) {
+	raw, err := os.ReadFile(filepath.Join(s.dir, spoolOffsetFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	var seg uint64
+	var off int64
+	if _, err := fmt.Sscanf(string(raw), "%d %d", &seg, &off); err != nil {
+		// A torn offset can only replay records twice, never skip them
+		return 0, 0, nil
+	}
+
+	return seg, off, nil
+}
+
+// saveOffset writes the read position to a temporary file and renames it
+// over the offset file.
+func (s *spool) saveOffset() error {
+	path := filepath.Join(s.dir, spoolOffsetFile)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(f, "%d %d\n", s.readSeg, s.readOff); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,286 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func openTestSpool(t *testing.T, dir string) *spool {
+	s, err := openSpool(dir, DefaultSpoolMaxBytes, DefaultSpoolMaxAge)
+	if err != nil {
+		t.Fatalf("openSpool() error = %v", err)
+	}
+
+	return s
+}
+
+// replayAll peeks and commits every record left in the spool.
+func replayAll(t *testing.T, s *spool) []string {
+	var bodies []string
+	for {
+		rec, err := s.peek()
+		if errors.Is(err, errSpoolEmpty) {
+			return bodies
+		} else if err != nil {
+			t.Fatalf("peek() error = %v", err)
+		}
+
+		bodies = append(bodies, string(rec.body))
+		if err := s.commit(rec); err != nil {
+			t.Fatalf("commit() error = %v", err)
+		}
+	}
+}
+
+func TestSpool_Order(t *testing.T) {
+	s := openTestSpool(t, t.TempDir())
+	s.segmentSize = 32 // a couple of records per segment
+
+	expected := []string{"one", "two", "three", "four", "five"}
+	for _, body := range expected {
+		if err := s.append([]byte(body), 1); err != nil {
+			t.Fatalf("append() error = %v", err)
+		}
+	}
+
+	if !s.pending() {
+		t.Fatalf("expected pending records")
+	}
+
+	got := replayAll(t, s)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+
+	if s.pending() {
+		t.Errorf("expected no pending records")
+	}
+}
+
+func TestSpool_Resume(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir)
+
+	for _, body := range []string{"one", "two", "three"} {
+		_ = s.append([]byte(body), 1)
+	}
+
+	rec, _ := s.peek()
+	_ = s.commit(rec)
+	_ = s.close()
+
+	// Reopening resumes after the committed record
+	s = openTestSpool(t, dir)
+	_ = s.append([]byte("four"), 1)
+
+	got := replayAll(t, s)
+	expected := []string{"two", "three", "four"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestSpool_Corruption(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir)
+	_ = s.append([]byte("corrupted"), 1)
+	_ = s.close()
+	_ = s.append([]byte("intact"), 1)
+	_ = s.close()
+
+	// Flip a byte in the body of the first segment
+	path := s.path(1)
+	raw, _ := os.ReadFile(path)
+	raw[len(raw)-1] ^= 0xff
+	_ = os.WriteFile(path, raw, 0o600)
+
+	s = openTestSpool(t, dir)
+	corrupted := 0
+	s.corrupted = func() { corrupted++ }
+
+	got := replayAll(t, s)
+	if len(got) != 1 || got[0] != "intact" {
+		t.Errorf("expected only the intact record, got %v", got)
+	}
+
+	if corrupted != 1 {
+		t.Errorf("expected 1 corrupted record, got %d", corrupted)
+	}
+}
+
+func TestSpool_CorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSpool(t, dir)
+	for i, body := range []string{"first", "second", "third"} {
+		_ = s.append([]byte(body), i+1)
+	}
+	_ = s.close()
+
+	// A damaged length must not be trusted to size the body, and the
+	// records after it are still found
+	path := s.path(1)
+	raw, _ := os.ReadFile(path)
+	copy(raw[4:8], []byte{0xff, 0xff, 0xff, 0xff})
+	_ = os.WriteFile(path, raw, 0o600)
+
+	s = openTestSpool(t, dir)
+	corrupted, dropped := 0, 0
+	s.corrupted = func() { corrupted++ }
+	s.dropped = func(count int) { dropped += count }
+
+	got := replayAll(t, s)
+	if len(got) != 2 || got[0] != "second" || got[1] != "third" {
+		t.Errorf("expected the records after the corrupt one, got %v", got)
+	}
+
+	if corrupted != 1 || dropped != 0 {
+		t.Errorf("expected 1 corrupted record and no dropped logs, got %d and %d", corrupted, dropped)
+	}
+}
+
+func TestSpool_CorruptMiddle(t *testing.T) {
+	s := openTestSpool(t, t.TempDir())
+	for _, body := range []string{"first", "second", "third", "fourth"} {
+		_ = s.append([]byte(body), 1)
+	}
+
+	// Flip a byte in the body of the second record of the active segment
+	path := s.path(s.writeSeg)
+	raw, _ := os.ReadFile(path)
+	raw[2*spoolHeaderSize+len("first")] ^= 0xff
+	_ = os.WriteFile(path, raw, 0o600)
+
+	corrupted := 0
+	s.corrupted = func() { corrupted++ }
+
+	got := replayAll(t, s)
+	expected := []string{"first", "third", "fourth"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+
+	if corrupted != 1 {
+		t.Errorf("expected 1 corrupted record, got %d", corrupted)
+	}
+
+	if s.pending() {
+		t.Errorf("expected no pending records")
+	}
+}
+
+func TestSpool_MaxBytes(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 64, DefaultSpoolMaxAge)
+	if err != nil {
+		t.Fatalf("openSpool() error = %v", err)
+	}
+
+	dropped := 0
+	s.dropped = func(count int) { dropped += count }
+
+	for _, body := range []string{"aaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccc", "dddddddddddddddddddd"} {
+		_ = s.append([]byte(body), 2)
+	}
+
+	got := replayAll(t, s)
+	if len(got) == 0 || got[len(got)-1] != "dddddddddddddddddddd" {
+		t.Fatalf("expected the newest record to be kept, got %v", got)
+	}
+
+	if dropped != 2*(4-len(got)) {
+		t.Errorf("expected %d dropped logs, got %d", 2*(4-len(got)), dropped)
+	}
+}
+
+func TestSpool_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := openSpool(dir, DefaultSpoolMaxBytes, time.Hour)
+	_ = s.append([]byte("old"), 3)
+	_ = s.close()
+
+	old := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(s.path(1), old, old)
+
+	s, _ = openSpool(dir, DefaultSpoolMaxBytes, time.Hour)
+	dropped := 0
+	s.dropped = func(count int) { dropped += count }
+	s.trim()
+
+	if got := replayAll(t, s); len(got) != 0 {
+		t.Errorf("expected the old record to be dropped, got %v", got)
+	}
+
+	if dropped != 3 {
+		t.Errorf("expected 3 dropped logs, got %d", dropped)
+	}
+}
+
+func TestClient_Spool(t *testing.T) {
+	down := true
+	srv := newTestServer(t)
+	srv.respond = func(r *http.Request) int {
+		if down {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+
+	c := newTestClient(t, Config{
+		URL:        srv.URL,
+		MaxRetries: -1,
+		SpoolDir:   t.TempDir(),
+	})
+
+	for _, msg := range []string{"a", "b"} {
+		_ = c.Send(testLog(msg))
+		if err := c.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	}
+
+	if got := c.Stats(); got.Spooled != 2 || got.Sent != 0 || got.Dropped != 0 {
+		t.Fatalf("unexpected stats while down %+v", got)
+	}
+
+	down = false
+	_ = c.Send(testLog("c"))
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if got := c.Stats(); got.Sent != 3 || got.Dropped != 0 {
+		t.Fatalf("unexpected stats after recovery %+v", got)
+	}
+
+	var messages []string
+	for _, batch := range srv.received() {
+		for _, log := range batch {
+			messages = append(messages, log.Message)
+		}
+	}
+
+	if len(messages) != 3 || messages[0] != "a" || messages[1] != "b" || messages[2] != "c" {
+		t.Errorf("expected logs to be delivered in order, got %v", messages)
+	}
+}
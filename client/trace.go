@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The W3C Trace Context headers, https://www.w3.org/TR/trace-context/
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+var errInvalidTraceParent = errors.New("invalid traceparent")
+
+// TraceContext is the span a request is served in, and the trace it is
+// part of. Logs sent by Middleware carry its TraceID and SpanID.
+type TraceContext struct {
+	// TraceID is 32 and SpanID 16 lowercase hex characters
+	TraceID string
+	SpanID  string
+
+	// Flags are the trace flags, where 0x01 means the trace is sampled
+	Flags byte
+
+	// State is the vendor specific tracestate, passed on unchanged
+	State string
+}
+
+// NewTraceContext starts a new trace.
+func NewTraceContext() TraceContext {
+	return TraceContext{TraceID: randomHex(16), SpanID: randomHex(8)}
+}
+
+// ParseTraceParent reads a traceparent header. Versions after 00 are read
+// as 00, ignoring anything they append.
+func ParseTraceParent(header string) (TraceContext, error) {
+	header = strings.TrimSpace(header)
+	if len(header) < 55 || (len(header) > 55 && header[55] != '-') {
+		return TraceContext{}, errInvalidTraceParent
+	}
+
+	version, traceID, spanID, flags := header[0:2], header[3:35], header[36:52], header[53:55]
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return TraceContext{}, errInvalidTraceParent
+	}
+
+	for _, field := range []string{version, traceID, spanID, flags} {
+		if !isLowerHex(field) {
+			return TraceContext{}, errInvalidTraceParent
+		}
+	}
+
+	if version == "ff" || (version == "00" && len(header) != 55) {
+		return TraceContext{}, errInvalidTraceParent
+	}
+
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return TraceContext{}, errInvalidTraceParent
+	}
+
+	b, _ := hex.DecodeString(flags)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: b[0]}, nil
+}
+
+// TraceParent returns the traceparent header for the span.
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// Child returns a new span in the same trace.
+func (tc TraceContext) Child() TraceContext {
+	tc.SpanID = randomHex(8)
+	return tc
+}
+
+// ContextWithTrace returns a copy of ctx carrying the trace context.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey, tc)
+}
+
+// TraceFromContext returns the trace context stored in ctx by Middleware or
+// ContextWithTrace.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey).(TraceContext)
+	return tc, ok
+}
+
+// Transport is an http.RoundTripper which propagates the trace context of
+// each request's context, so that the logs of the servers it calls join
+// the same trace, e.g.
+//
+//	client := &http.Client{Transport: &client.Transport{}}
+//	req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+//
+// Requests without a trace context are sent unchanged.
+type Transport struct {
+	// Base sends the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	tc, ok := TraceFromContext(r.Context())
+	if !ok {
+		return base.RoundTrip(r)
+	}
+
+	// A RoundTripper must not modify the request it is given
+	r = r.Clone(r.Context())
+	r.Header.Set(TraceParentHeader, tc.TraceParent())
+	if tc.State != "" {
+		r.Header.Set(TraceStateHeader, tc.State)
+	} else {
+		r.Header.Del(TraceStateHeader)
+	}
+
+	return base.RoundTrip(r)
+}
+
+// traceFromRequest continues the trace of the request's traceparent in a
+// new span, or starts a new trace if it has none.
+func traceFromRequest(r *http.Request) TraceContext {
+	parent, err := ParseTraceParent(r.Header.Get(TraceParentHeader))
+	if err != nil {
+		return NewTraceContext()
+	}
+
+	parent.State = r.Header.Get(TraceStateHeader)
+	return parent.Child()
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
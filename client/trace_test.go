@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m4tth3/loggui/client/internal/clienttest"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tc, err := ParseTraceParent(valid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.SpanID != "00f067aa0ba902b7" || tc.Flags != 1 {
+		t.Errorf("unexpected trace context %+v", tc)
+	}
+
+	if tc.TraceParent() != valid {
+		t.Errorf("expected %s, got %s", valid, tc.TraceParent())
+	}
+
+	// Later versions may append fields, which are ignored
+	if tc, err := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil || tc.Flags != 0 {
+		t.Errorf("expected a later version to be read, got %+v %v", tc, err)
+	}
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+	} {
+		if _, err := ParseTraceParent(header); err == nil {
+			t.Errorf("expected %q to be rejected", header)
+		}
+	}
+}
+
+func TestTraceContext_New(t *testing.T) {
+	tc := NewTraceContext()
+	if _, err := ParseTraceParent(tc.TraceParent()); err != nil {
+		t.Errorf("expected a new trace to be valid, got %v", err)
+	}
+
+	child := tc.Child()
+	if child.TraceID != tc.TraceID || child.SpanID == tc.SpanID {
+		t.Errorf("expected a new span in the same trace, got %+v from %+v", child, tc)
+	}
+}
+
+func TestMiddleware_Trace(t *testing.T) {
+	sender := &clienttest.Sender{}
+
+	var tc TraceContext
+	handler := Middleware(sender, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, _ = TraceFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TraceStateHeader, "vendor=value")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The request is served in a new span of the caller's trace
+	if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.SpanID == "00f067aa0ba902b7" || tc.Flags != 1 || tc.State != "vendor=value" {
+		t.Errorf("unexpected trace context %+v", tc)
+	}
+
+	log := sender.Last(t)
+	if log.TraceID == nil || *log.TraceID != tc.TraceID || log.SpanID == nil || *log.SpanID != tc.SpanID {
+		t.Errorf("expected the log to carry the trace context, got %v/%v", log.TraceID, log.SpanID)
+	}
+
+	// Without a valid traceparent a new trace is started
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceParentHeader, "nope")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if tc.TraceID == "" || tc.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected a new trace, got %+v", tc)
+	}
+}
+
+func TestSlogHandler_TraceFromContext(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := slog.New(NewSlogHandler(sender, nil))
+
+	logger.Info("untraced")
+	if log := sender.Last(t); log.TraceID != nil || log.SpanID != nil {
+		t.Errorf("expected no trace context, got %v/%v", log.TraceID, log.SpanID)
+	}
+
+	tc := NewTraceContext()
+	logger.InfoContext(ContextWithTrace(context.Background(), tc), "traced")
+	if log := sender.Last(t); log.TraceID == nil || *log.TraceID != tc.TraceID {
+		t.Errorf("expected the trace of the context, got %v", log.TraceID)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	tc := TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: 1, State: "vendor=value"}
+
+	req, _ := http.NewRequestWithContext(ContextWithTrace(context.Background(), tc), http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if headers.Get(TraceParentHeader) != tc.TraceParent() || headers.Get(TraceStateHeader) != "vendor=value" {
+		t.Errorf("expected the trace context to be propagated, got %v", headers)
+	}
+
+	if req.Header.Get(TraceParentHeader) != "" {
+		t.Error("expected the request not to be modified")
+	}
+
+	// Requests without a trace context are sent unchanged
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if headers.Get(TraceParentHeader) != "" {
+		t.Errorf("expected no traceparent, got %s", headers.Get(TraceParentHeader))
+	}
+}
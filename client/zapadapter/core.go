@@ -0,0 +1,197 @@
+package zapadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/m4tth3/loggui/client"
+	"github.com/m4tth3/loggui/core"
+	"go.uber.org/zap/zapcore"
+)
+
+// This package provides a zapcore.Core which ships zap logs to loggui, e.g.
+// to tee an existing logger:
+//
+//	logger = logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+//		return zapcore.NewTee(c, zapadapter.NewCore(lc, nil))
+//	}))
+
+// Options configures a Core.
+//
+// Source and Group are used for every log unless an entry has a string
+// field named SourceKey or GroupKey, whose value is used instead. Those
+// fields are not rendered into the message.
+type Options struct {
+	// Level decides which entries are sent. Defaults to zapcore.InfoLevel.
+	Level zapcore.LevelEnabler
+
+	Source string
+	Group  string
+
+	SourceKey string
+	GroupKey  string
+}
+
+// Core converts zap entries into core.Log and sends them through a
+// client.Sender. The fields become the log's Attributes, along with the
+// logger name, caller and stack trace if the entry has them,
+//
+//	{"logger": "http", "caller": "api/h.go:12", "status": 200}
+//
+// Implements zapcore.Core
+type Core struct {
+	zapcore.LevelEnabler
+
+	sender client.Sender
+	opts   Options
+
+	// fields are the fields added by With
+	fields []zapcore.Field
+	source *string
+	group  *string
+}
+
+func NewCore(sender client.Sender, opts *Options) *Core {
+	c := &Core{sender: sender}
+
+	if opts != nil {
+		c.opts = *opts
+	}
+
+	if c.opts.Level == nil {
+		c.opts.Level = zapcore.InfoLevel
+	}
+	c.LevelEnabler = c.opts.Level
+
+	if c.opts.Source != "" {
+		c.source = &c.opts.Source
+	}
+
+	if c.opts.Group != "" {
+		c.group = &c.opts.Group
+	}
+
+	return c
+}
+
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	c2 := *c
+	c2.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	c2.fields = append(c2.fields, c.fields...)
+
+	for _, f := range fields {
+		if !c2.takeKey(f, &c2.source, &c2.group) {
+			c2.fields = append(c2.fields, f)
+		}
+	}
+
+	return &c2
+}
+
+func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c *Core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	source, group := c.source, c.group
+	enc := zapcore.NewMapObjectEncoder()
+
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+
+	for _, f := range fields {
+		if !c.takeKey(f, &source, &group) {
+			f.AddTo(enc)
+		}
+	}
+
+	if ent.LoggerName != "" {
+		enc.Fields["logger"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		enc.Fields["caller"] = ent.Caller.TrimmedPath()
+	}
+	if ent.Stack != "" {
+		enc.Fields["stacktrace"] = ent.Stack
+	}
+
+	attributes, err := client.EncodeAttributes(enc.Fields)
+	if err != nil {
+		return err
+	}
+
+	recordedAt := ent.Time
+	if recordedAt.IsZero() {
+		recordedAt = time.Now()
+	}
+
+	err = c.sender.Send(&core.Log{
+		Level:      Level(ent.Level),
+		Source:     source,
+		Group:      group,
+		Message:    ent.Message,
+		RecordedAt: recordedAt,
+		Attributes: attributes,
+	})
+	if err != nil {
+		return err
+	}
+
+	// zap panics or exits right after writing these, so they have to be
+	// delivered now.
+	if ent.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+
+	return nil
+}
+
+// Sync flushes the underlying sender.
+func (c *Core) Sync() error {
+	return c.sender.Flush(context.Background())
+}
+
+// takeKey picks up the source and group fields. It reports whether the
+// field was taken.
+func (c *Core) takeKey(f zapcore.Field, source, group **string) bool {
+	if f.Type != zapcore.StringType {
+		return false
+	}
+
+	switch {
+	case c.opts.SourceKey != "" && f.Key == c.opts.SourceKey:
+		value := f.String
+		*source = &value
+		return true
+	case c.opts.GroupKey != "" && f.Key == c.opts.GroupKey:
+		value := f.String
+		*group = &value
+		return true
+	}
+
+	return false
+}
+
+// Level maps a zap level onto core.Level. DPanic, Panic and Fatal are all
+// treated as FATAL, and any custom level below Debug as TRACE.
+func Level(l zapcore.Level) core.Level {
+	switch {
+	case l < zapcore.DebugLevel:
+		return core.TRACE
+	case l == zapcore.DebugLevel:
+		return core.DEBUG
+	case l == zapcore.InfoLevel:
+		return core.INFO
+	case l == zapcore.WarnLevel:
+		return core.WARN
+	case l == zapcore.ErrorLevel:
+		return core.ERROR
+	default:
+		return core.FATAL
+	}
+}
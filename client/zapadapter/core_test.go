@@ -0,0 +1,109 @@
+package zapadapter
+
+import (
+	"testing"
+
+	"github.com/m4tth3/loggui/client/internal/clienttest"
+	"github.com/m4tth3/loggui/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		level    zapcore.Level
+		expected core.Level
+	}{
+		{zapcore.DebugLevel - 1, core.TRACE},
+		{zapcore.DebugLevel, core.DEBUG},
+		{zapcore.InfoLevel, core.INFO},
+		{zapcore.WarnLevel, core.WARN},
+		{zapcore.ErrorLevel, core.ERROR},
+		{zapcore.DPanicLevel, core.FATAL},
+		{zapcore.PanicLevel, core.FATAL},
+		{zapcore.FatalLevel, core.FATAL},
+	}
+
+	for _, tt := range tests {
+		if got := Level(tt.level); got != tt.expected {
+			t.Errorf("Level(%v) = %v, want %v", tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestCore_Write(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := zap.New(NewCore(sender, &Options{
+		Level:     zapcore.DebugLevel,
+		Source:    "default",
+		GroupKey:  "request_id",
+		SourceKey: "service",
+	})).Named("http")
+
+	logger = logger.With(zap.String("service", "api"), zap.Int("version", 2))
+	logger.Debug("served", zap.String("request_id", "abc"), zap.Namespace("req"), zap.String("path", "/"))
+
+	if len(sender.Logs()) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(sender.Logs()))
+	}
+
+	log := sender.Logs()[0]
+	if log.Level != core.DEBUG || log.Message != "served" || log.IsMessageJson {
+		t.Errorf("unexpected log %+v", log)
+	}
+
+	if log.Source == nil || *log.Source != "api" || log.Group == nil || *log.Group != "abc" {
+		t.Errorf("unexpected source/group %v/%v", log.Source, log.Group)
+	}
+
+	m := clienttest.DecodeAttributes(t, log)
+	req, _ := m["req"].(map[string]any)
+	if m["logger"] != "http" || m["version"] != float64(2) || req["path"] != "/" {
+		t.Errorf("unexpected attributes %v", m)
+	}
+
+	if _, ok := m["service"]; ok {
+		t.Errorf("source field should not be kept, got %v", m)
+	}
+}
+
+func TestCore_NoFields(t *testing.T) {
+	sender := &clienttest.Sender{}
+	zap.New(NewCore(sender, nil)).Info("plain")
+
+	if log := sender.Logs()[0]; log.Message != "plain" || log.Attributes != nil {
+		t.Errorf("expected a plain log without attributes, got %+v", log)
+	}
+}
+
+func TestCore_LevelEnabler(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := zap.New(NewCore(sender, nil))
+
+	logger.Debug("ignored")
+	logger.Info("sent")
+
+	if len(sender.Logs()) != 1 {
+		t.Errorf("expected only the info log, got %d logs", len(sender.Logs()))
+	}
+}
+
+func TestCore_Sync(t *testing.T) {
+	sender := &clienttest.Sender{}
+	logger := zap.New(NewCore(sender, nil))
+
+	logger.Error("not flushed")
+	if sender.Flushed() != 0 {
+		t.Errorf("error logs should not flush")
+	}
+
+	logger.DPanic("flushed")
+	if sender.Flushed() != 1 {
+		t.Errorf("expected DPanic to flush, got %d flushes", sender.Flushed())
+	}
+
+	_ = logger.Sync()
+	if sender.Flushed() != 2 {
+		t.Errorf("expected Sync to flush, got %d flushes", sender.Flushed())
+	}
+}
@@ -0,0 +1,196 @@
+package zerologadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/m4tth3/loggui/client"
+	"github.com/m4tth3/loggui/core"
+	"github.com/rs/zerolog"
+)
+
+// This package provides a zerolog.LevelWriter which ships zerolog events to
+// loggui, e.g. next to the existing output:
+//
+//	logger := zerolog.New(zerolog.MultiLevelWriter(os.Stderr, zerologadapter.NewWriter(lc, nil)))
+
+// Options configures a Writer.
+//
+// Source and Group are used for every log unless an event has a string
+// field named SourceKey or GroupKey, whose value is used instead. Those
+// fields are not rendered into the message.
+type Options struct {
+	Source string
+	Group  string
+
+	SourceKey string
+	GroupKey  string
+}
+
+// Writer parses the JSON events written by zerolog into core.Log and sends
+// them through a client.Sender. The level, timestamp and message are taken
+// out of the event, and the remaining fields become the log's Attributes,
+//
+//	{"caller": "api/h.go:12", "status": 200}
+//
+// Implements zerolog.LevelWriter
+type Writer struct {
+	sender client.Sender
+	opts   Options
+}
+
+func NewWriter(sender client.Sender, opts *Options) *Writer {
+	w := &Writer{sender: sender}
+
+	if opts != nil {
+		w.opts = *opts
+	}
+
+	return w
+}
+
+// Write sends a single event, reading its level from the level field.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.write(p, nil)
+}
+
+// WriteLevel sends a single event at the given level.
+func (w *Writer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	return w.write(p, &level)
+}
+
+func (w *Writer) write(p []byte, level *zerolog.Level) (int, error) {
+	log := &core.Log{
+		Level:      core.INFO,
+		RecordedAt: time.Now(),
+	}
+
+	if w.opts.Source != "" {
+		log.Source = &w.opts.Source
+	}
+	if w.opts.Group != "" {
+		log.Group = &w.opts.Group
+	}
+
+	var fields map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&fields); err != nil || fields == nil {
+		// Not written by zerolog's JSON encoder, so it is kept as it is
+		log.Message = string(bytes.TrimRight(p, "\n"))
+	} else {
+		w.fromFields(log, fields, &level)
+
+		if len(fields) > 0 {
+			log.Attributes = fields
+		}
+	}
+
+	if level != nil {
+		log.Level = Level(*level)
+	}
+
+	if err := w.sender.Send(log); err != nil {
+		return 0, err
+	}
+
+	// zerolog panics or exits right after writing these, so they have to be
+	// delivered now.
+	if level != nil && (*level == zerolog.FatalLevel || *level == zerolog.PanicLevel) {
+		if err := w.sender.Flush(context.Background()); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// fromFields moves the level, timestamp, message, source and group out of
+// the event fields and into the log.
+func (w *Writer) fromFields(log *core.Log, fields map[string]any, level **zerolog.Level) {
+	if raw, ok := fields[zerolog.LevelFieldName].(string); ok {
+		delete(fields, zerolog.LevelFieldName)
+
+		if parsed, err := zerolog.ParseLevel(raw); err == nil && *level == nil {
+			*level = &parsed
+		}
+	}
+
+	if raw, ok := fields[zerolog.TimestampFieldName]; ok {
+		if t, ok := parseTime(raw); ok {
+			delete(fields, zerolog.TimestampFieldName)
+			log.RecordedAt = t
+		}
+	}
+
+	if msg, ok := fields[zerolog.MessageFieldName].(string); ok {
+		delete(fields, zerolog.MessageFieldName)
+		log.Message = msg
+	}
+
+	if value, ok := fields[w.opts.SourceKey].(string); ok && w.opts.SourceKey != "" {
+		delete(fields, w.opts.SourceKey)
+		log.Source = &value
+	}
+
+	if value, ok := fields[w.opts.GroupKey].(string); ok && w.opts.GroupKey != "" {
+		delete(fields, w.opts.GroupKey)
+		log.Group = &value
+	}
+}
+
+// parseTime reads a timestamp in the format zerolog is configured to write.
+func parseTime(raw any) (time.Time, bool) {
+	switch v := raw.(type) {
+	case string:
+		format := zerolog.TimeFieldFormat
+		switch format {
+		case zerolog.TimeFormatUnix, zerolog.TimeFormatUnixMs, zerolog.TimeFormatUnixMicro, zerolog.TimeFormatUnixNano:
+			format = time.RFC3339Nano
+		}
+
+		t, err := time.Parse(format, v)
+		return t, err == nil
+	case json.Number:
+		n, err := strconv.ParseInt(v.String(), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		switch zerolog.TimeFieldFormat {
+		case zerolog.TimeFormatUnixMs:
+			return time.UnixMilli(n), true
+		case zerolog.TimeFormatUnixMicro:
+			return time.UnixMicro(n), true
+		case zerolog.TimeFormatUnixNano:
+			return time.Unix(0, n), true
+		default:
+			return time.Unix(n, 0), true
+		}
+	default:
+		return time.Time{}, false
+	}
+}
+
+// Level maps a zerolog level onto core.Level. Panic is treated as FATAL, any
+// custom level below Trace as TRACE, and NoLevel as INFO.
+func Level(l zerolog.Level) core.Level {
+	switch {
+	case l <= zerolog.TraceLevel:
+		return core.TRACE
+	case l == zerolog.DebugLevel:
+		return core.DEBUG
+	case l == zerolog.WarnLevel:
+		return core.WARN
+	case l == zerolog.ErrorLevel:
+		return core.ERROR
+	case l == zerolog.FatalLevel || l == zerolog.PanicLevel:
+		return core.FATAL
+	default:
+		return core.INFO
+	}
+}
@@ -0,0 +1,106 @@
+package zerologadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/client/internal/clienttest"
+	"github.com/m4tth3/loggui/core"
+	"github.com/rs/zerolog"
+)
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		level    zerolog.Level
+		expected core.Level
+	}{
+		{zerolog.TraceLevel - 1, core.TRACE},
+		{zerolog.TraceLevel, core.TRACE},
+		{zerolog.DebugLevel, core.DEBUG},
+		{zerolog.InfoLevel, core.INFO},
+		{zerolog.WarnLevel, core.WARN},
+		{zerolog.ErrorLevel, core.ERROR},
+		{zerolog.FatalLevel, core.FATAL},
+		{zerolog.PanicLevel, core.FATAL},
+		{zerolog.NoLevel, core.INFO},
+	}
+
+	for _, tt := range tests {
+		if got := Level(tt.level); got != tt.expected {
+			t.Errorf("Level(%v) = %v, want %v", tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	sender := &clienttest.Sender{}
+	recordedAt := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	logger := zerolog.New(NewWriter(sender, &Options{
+		Source:    "default",
+		SourceKey: "service",
+		GroupKey:  "request_id",
+	})).With().Str("service", "api").Time(zerolog.TimestampFieldName, recordedAt).Logger()
+
+	logger.Warn().Str("request_id", "abc").Int("status", 200).Dict("req", zerolog.Dict().Str("path", "/")).Msg("served")
+
+	if len(sender.Logs()) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(sender.Logs()))
+	}
+
+	log := sender.Logs()[0]
+	if log.Level != core.WARN || log.Message != "served" || log.IsMessageJson || !log.RecordedAt.Equal(recordedAt) {
+		t.Errorf("unexpected log %+v", log)
+	}
+
+	if log.Source == nil || *log.Source != "api" || log.Group == nil || *log.Group != "abc" {
+		t.Errorf("unexpected source/group %v/%v", log.Source, log.Group)
+	}
+
+	m := clienttest.DecodeAttributes(t, log)
+	req, _ := m["req"].(map[string]any)
+	if m["status"] != float64(200) || req["path"] != "/" {
+		t.Errorf("unexpected attributes %v", m)
+	}
+
+	for _, key := range []string{"service", "request_id", zerolog.LevelFieldName, zerolog.TimestampFieldName, zerolog.MessageFieldName} {
+		if _, ok := m[key]; ok {
+			t.Errorf("%s should not be kept, got %v", key, m)
+		}
+	}
+}
+
+func TestWriter_Write(t *testing.T) {
+	sender := &clienttest.Sender{}
+	w := NewWriter(sender, nil)
+
+	_, _ = w.Write([]byte(`{"level":"error","message":"failed"}` + "\n"))
+	_, _ = w.Write([]byte("not json\n"))
+
+	if len(sender.Logs()) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(sender.Logs()))
+	}
+
+	if log := sender.Logs()[0]; log.Level != core.ERROR || log.Message != "failed" || log.Attributes != nil {
+		t.Errorf("unexpected log %+v", log)
+	}
+
+	if log := sender.Logs()[1]; log.Level != core.INFO || log.IsMessageJson || log.Message != "not json" {
+		t.Errorf("unexpected log %+v", log)
+	}
+}
+
+func TestWriter_Flush(t *testing.T) {
+	sender := &clienttest.Sender{}
+	w := NewWriter(sender, nil)
+
+	_, _ = w.WriteLevel(zerolog.ErrorLevel, []byte(`{"message":"not flushed"}`))
+	if sender.Flushed() != 0 {
+		t.Errorf("error logs should not flush")
+	}
+
+	_, _ = w.WriteLevel(zerolog.PanicLevel, []byte(`{"message":"flushed"}`))
+	if sender.Flushed() != 1 {
+		t.Errorf("expected panic to flush, got %d flushes", sender.Flushed())
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/m4tth3/loggui/core
 
 go 1.24
+
+require github.com/google/uuid v1.6.0
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Level int
+
+// Log.Level(s) are defined as follows:
+const (
+	TRACE Level = iota
+	DEBUG
+	INFO
+	WARN
+	ERROR
+	FATAL
+)
+
+// levelNames are the names of the levels, in order
+var levelNames = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+var (
+	aliasLock sync.RWMutex
+
+	// levelAliases are the other names ParseLevel accepts, including the
+	// syslog severities
+	levelAliases = map[string]Level{
+		"warning":       WARN,
+		"notice":        INFO,
+		"informational": INFO,
+		"err":           ERROR,
+		"crit":          FATAL,
+		"critical":      FATAL,
+		"alert":         FATAL,
+		"emerg":         FATAL,
+		"emergency":     FATAL,
+		"panic":         FATAL,
+	}
+)
+
+// String returns the string representation of the log level.
+// It is used for logging and displaying the log level in the UI. A level
+// which is not defined is shown by its number, e.g. "level(9)".
+func (l Level) String() string {
+	if l.Valid() {
+		return levelNames[l]
+	}
+
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Valid reports whether the level is one of those defined.
+func (l Level) Valid() bool {
+	return l >= TRACE && l <= FATAL
+}
+
+// ParseLevel reads a level by its name or an alias, e.g. "warn" or
+// "warning", ignoring case. A number is read as the level it is, whether or
+// not it is defined, so that it round-trips with MarshalText.
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+
+	for i, levelName := range levelNames {
+		if name == levelName {
+			return Level(i), nil
+		}
+	}
+
+	aliasLock.RLock()
+	level, ok := levelAliases[name]
+	aliasLock.RUnlock()
+
+	if ok {
+		return level, nil
+	}
+
+	if n, err := strconv.Atoi(name); err == nil {
+		return Level(n), nil
+	}
+
+	return 0, fmt.Errorf("unknown level %q", s)
+}
+
+// RegisterLevelAlias makes ParseLevel read alias as the level, e.g. the
+// name another logger gives it. It replaces an alias of the same name, but
+// the names of the levels themselves cannot be changed.
+func RegisterLevelAlias(alias string, level Level) error {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+
+	if alias == "" {
+		return errors.New("alias is empty")
+	}
+
+	if !level.Valid() {
+		return fmt.Errorf("unknown level %d", int(level))
+	}
+
+	for _, name := range levelNames {
+		if alias == name {
+			return fmt.Errorf("%q is already a level", alias)
+		}
+	}
+
+	aliasLock.Lock()
+	defer aliasLock.Unlock()
+
+	levelAliases[alias] = level
+	return nil
+}
+
+// MarshalText writes the level by its name, or its number if it is not
+// defined.
+//
+// Implements encoding.TextMarshaler
+func (l Level) MarshalText() ([]byte, error) {
+	if l.Valid() {
+		return []byte(levelNames[l]), nil
+	}
+
+	return []byte(strconv.Itoa(int(l))), nil
+}
+
+// UnmarshalText reads the level with ParseLevel.
+//
+// Implements encoding.TextUnmarshaler
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+
+	*l = level
+	return nil
+}
+
+// MarshalJSON writes the level as a string of its name, e.g. "warn", or as
+// a number if it is not defined.
+//
+// Implements json.Marshaler
+func (l Level) MarshalJSON() ([]byte, error) {
+	if l.Valid() {
+		return json.Marshal(levelNames[l])
+	}
+
+	return []byte(strconv.Itoa(int(l))), nil
+}
+
+// UnmarshalJSON reads the level from a string with ParseLevel, or from a
+// number, which producers sent before levels were named.
+//
+// Implements json.Unmarshaler
+func (l *Level) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*l = Level(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("level must be a string or a number: %s", data)
+	}
+
+	return l.UnmarshalText([]byte(s))
+}
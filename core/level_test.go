@@ -0,0 +1,115 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLevelString(t *testing.T) {
+	tests := []struct {
+		level    Level
+		expected string
+	}{
+		{TRACE, "trace"},
+		{DEBUG, "debug"},
+		{INFO, "info"},
+		{WARN, "warn"},
+		{ERROR, "error"},
+		{FATAL, "fatal"},
+		{Level(999), "level(999)"},
+		{Level(-1), "level(-1)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			if result := test.level.String(); result != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected Level
+	}{
+		{"trace", TRACE},
+		{"WARN", WARN},
+		{" error ", ERROR},
+		{"warning", WARN},
+		{"notice", INFO},
+		{"critical", FATAL},
+		{"emerg", FATAL},
+		{"3", WARN},
+		{"9", Level(9)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			level, err := ParseLevel(test.raw)
+			if err != nil || level != test.expected {
+				t.Errorf("expected %v, got %v %v", test.expected, level, err)
+			}
+		})
+	}
+
+	for _, raw := range []string{"", "loud", "level(9)"} {
+		if _, err := ParseLevel(raw); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestRegisterLevelAlias(t *testing.T) {
+	if err := RegisterLevelAlias("Verbose", DEBUG); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if level, err := ParseLevel("verbose"); err != nil || level != DEBUG {
+		t.Errorf("expected the alias to be read as debug, got %v %v", level, err)
+	}
+
+	for alias, level := range map[string]Level{"": INFO, "info": DEBUG, "huge": Level(9)} {
+		if err := RegisterLevelAlias(alias, level); err == nil {
+			t.Errorf("expected alias %q for %v to be rejected", alias, level)
+		}
+	}
+}
+
+func TestLevelJSON(t *testing.T) {
+	encoded, err := json.Marshal(map[string]Level{"known": WARN, "unknown": Level(9)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := `{"known":"warn","unknown":9}`; string(encoded) != expected {
+		t.Errorf("expected %s, got %s", expected, encoded)
+	}
+
+	// Levels are read by name, alias or number
+	var levels []Level
+	if err := json.Unmarshal([]byte(`["warn", "critical", 2, 9]`), &levels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Level{WARN, FATAL, INFO, Level(9)}
+	for i, level := range levels {
+		if level != expected[i] {
+			t.Errorf("level %d: expected %v, got %v", i, expected[i], level)
+		}
+	}
+
+	for _, raw := range []string{`"loud"`, `true`, `2.5`} {
+		var level Level
+		if err := json.Unmarshal([]byte(raw), &level); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+
+	// As a map key, a level is its text
+	var keys map[Level]int
+	if err := json.Unmarshal([]byte(`{"error": 1}`), &keys); err != nil || keys[ERROR] != 1 {
+		t.Errorf("expected a level key, got %v %v", keys, err)
+	}
+}
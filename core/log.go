@@ -1,45 +1,25 @@
 package core
 
-import "time"
-
-type Level int
-
-// Log.Level(s) are defined as follows:
-const (
-	TRACE Level = iota
-	DEBUG
-	INFO
-	WARN
-	ERROR
-	FATAL
-)
+import (
+	"hash/fnv"
+	"time"
 
-// String returns the string representation of the log level.
-// It is used for logging and displaying the log level in the UI.
-func (l Level) String() string {
-	switch l {
-	case TRACE:
-		return "trace"
-	case DEBUG:
-		return "debug"
-	case INFO:
-		return "info"
-	case WARN:
-		return "warn"
-	case ERROR:
-		return "error"
-	case FATAL:
-		return "fatal"
-	}
-
-	panic("unknown log level")
-}
+	"github.com/google/uuid"
+)
 
 // Log is the main data type sent/received by the server.
 //
+// ID identifies the log across retries, so that the server can drop the
+// copies of a log it has already received. It is a UUIDv7, which sorts by
+// the time it was created.
 // Source is an identifier we can label the sending source with.
-// Group is an identifier to group related logs together
+// Group is an identifier to group related logs together.
+// Attributes are the structured fields of the log, e.g. {"status": 200}.
+// TraceID and SpanID tie the log to the trace and span it was written in,
+// as lowercase hex in the W3C Trace Context format.
 type Log struct {
+	ID string `json:"id,omitempty"`
+
 	Level Level `json:"level"`
 
 	Source *string `json:"source"`
@@ -49,8 +29,27 @@ type Log struct {
 
 	IsMessageJson bool `json:"is_message_json"`
 
+	Attributes map[string]any `json:"attributes,omitempty"`
+
+	TraceID *string `json:"trace_id,omitempty"`
+	SpanID  *string `json:"span_id,omitempty"`
+
 	RecordedAt time.Time `json:"recorded_at"`
 
 	// We will use this time as the main source of time
 	ReceivedAt *time.Time `json:"created_at"`
 }
+
+// NewID returns a new log ID. IDs created later sort after those created
+// earlier, even within the same millisecond in this process.
+func NewID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// Hash returns the hash of the log's ID, so that logs can be kept in a set
+// by ID. Logs without an ID all have the same hash.
+func (l *Log) Hash() uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(l.ID))
+	return h.Sum64()
+}
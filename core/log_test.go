@@ -1,36 +1,51 @@
 package core
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 )
 
-func TestLevelString(t *testing.T) {
-	tests := []struct {
-		level    Level
-		expected string
-	}{
-		{TRACE, "trace"},
-		{DEBUG, "debug"},
-		{INFO, "info"},
-		{WARN, "warn"},
-		{ERROR, "error"},
-		{FATAL, "fatal"},
-	}
-
-	for _, test := range tests {
-		t.Run(test.expected, func(t *testing.T) {
-			if result := test.level.String(); result != test.expected {
-				t.Errorf("expected %s, got %s", test.expected, result)
-			}
-		})
-	}
-
-	t.Run("unknown level", func(t *testing.T) {
-		defer func() {
-			if r := recover(); r == nil {
-				t.Errorf("expected panic for unknown log level, but no panic occurred")
-			}
-		}()
-		_ = Level(999).String() // This should panic
-	})
+func TestLogAttributesJSON(t *testing.T) {
+	encoded, err := json.Marshal(&Log{Message: "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Contains(string(encoded), "attributes") {
+		t.Errorf("expected a log without attributes to leave them out, got %s", encoded)
+	}
+
+	var log Log
+	if err := json.Unmarshal([]byte(`{"message": "hello", "attributes": {"status": 200, "user": "bob"}}`), &log); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if log.Attributes["status"] != float64(200) || log.Attributes["user"] != "bob" {
+		t.Errorf("unexpected attributes %v", log.Attributes)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	first, second := NewID(), NewID()
+
+	if len(first) != 36 || first[14] != '7' {
+		t.Errorf("expected a UUIDv7, got %s", first)
+	}
+
+	if first >= second {
+		t.Errorf("expected %s to sort before %s", first, second)
+	}
+}
+
+func TestLogHash(t *testing.T) {
+	a, b := &Log{ID: NewID()}, &Log{ID: NewID()}
+
+	if a.Hash() == b.Hash() {
+		t.Error("expected logs with different IDs to have different hashes")
+	}
+
+	if a.Hash() != (&Log{ID: a.ID, Message: "retried"}).Hash() {
+		t.Error("expected the hash to only depend on the ID")
+	}
 }
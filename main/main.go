@@ -1,24 +1,169 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/m4tth3/loggui/server"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/m4tth3/loggui/server/database/memory"
+	"github.com/m4tth3/loggui/server/database/postgres"
+	"github.com/m4tth3/loggui/server/database/sqlite"
+	"github.com/m4tth3/loggui/server/storage"
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout is how long requests in flight are given to finish on
+// exit, and then how long pending logs are given to be persisted
+const shutdownTimeout = 10 * time.Second
+
 // Provide a compilable version of the server client
 func main() {
 	username := flag.String("username", "", "Non-empty username for the server")
 	password := flag.String("password", "", "Non-empty password for the server")
+	tokens := flag.String("tokens", "", "Comma separated bearer tokens also accepted by the server")
+	bufferSize := flag.Uint("buffer", 10000, "Number of recent logs kept in memory")
+	postgresURL := flag.String("postgres", "", "PostgreSQL connection URL to persist the logs to")
+	sqlitePath := flag.String("sqlite", "", "SQLite database file to persist the logs to")
+	memoryMaxAge := flag.Duration("memory", 0, "Keep logs in memory for this long instead of in a database, e.g. 24h")
+	memoryMaxSize := flag.Int("memory-max-size", 0, "Keep at most this many logs in memory instead of in a database")
+	dryRun := flag.Bool("migrate-dry-run", false, "List the pending database migrations and exit")
+
+	flag.Parse()
 
-	if *username == "" || *password == "" {
+	if !*dryRun && (*username == "" || *password == "") {
 		flag.Usage()
 		return
 	}
 
-	flag.Parse()
+	var db database.QueryHandler
+	var err error
+	switch {
+	case countSet(*postgresURL != "", *sqlitePath != "", *memoryMaxAge > 0 || *memoryMaxSize > 0) > 1:
+		log.Fatal("only one of -postgres, -sqlite and the -memory flags can be set")
+	case *postgresURL != "":
+		db, err = postgres.NewQueryHandler(*postgresURL)
+	case *sqlitePath != "" && *dryRun:
+		// A dry run must not create the database file
+		db, err = sqlite.NewReadOnlyQueryHandler(*sqlitePath)
+	case *sqlitePath != "":
+		db, err = sqlite.NewQueryHandler(*sqlitePath)
+	case *memoryMaxAge > 0 || *memoryMaxSize > 0:
+		db = memory.NewQueryHandler(memory.Config{MaxSize: *memoryMaxSize, MaxAge: *memoryMaxAge})
+	}
+
+	if err != nil {
+		log.Fatalf("failed to open the database: %v", err)
+	}
+
+	if *dryRun {
+		listMigrations(db)
+		return
+	}
 
-	srv := server.NewServer(*username, *password)
+	if db != nil {
+		if err := db.Init(); err != nil {
+			log.Fatalf("failed to initialise the database: %v", err)
+		}
+	}
+
+	manager := storage.NewLogManager(*bufferSize, db)
+	srv := server.NewServerWithConfig(server.Config{
+		Username: *username,
+		Password: *password,
+		Tokens:   splitTokens(*tokens),
+	}, manager)
+
+	httpServer := &http.Server{Addr: ":8080", Handler: srv}
+
+	go func() {
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	shutdown(httpServer, manager, db)
+}
+
+// shutdown stops accepting requests and waits for those in flight, so that
+// no log is written after the manager is closed. The manager then persists
+// its pending logs before the database is closed.
+func shutdown(httpServer *http.Server, manager *storage.LogManager, db database.QueryHandler) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Streams only end when their clients leave, so they are cut off once
+	// the timeout is up
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("failed to shut down the server: %v", err)
+		_ = httpServer.Close()
+	}
 
-	log.Fatal(srv.ListenAndServe(":8080"))
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := manager.Close(ctx); err != nil {
+		log.Printf("failed to close the log manager: %v", err)
+	}
+
+	if closer, ok := db.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("failed to close the database: %v", err)
+		}
+	}
+}
+
+// countSet counts the options which are set.
+func countSet(set ...bool) int {
+	n := 0
+	for _, ok := range set {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// splitTokens splits the comma separated tokens, ignoring empty ones.
+func splitTokens(raw string) []string {
+	var tokens []string
+	for _, token := range strings.Split(raw, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// listMigrations prints the migrations Init would apply to the database.
+func listMigrations(db database.QueryHandler) {
+	migrator, ok := db.(database.Migrator)
+	if !ok {
+		log.Fatal("-migrate-dry-run requires -postgres or -sqlite")
+	}
+
+	pending, err := migrator.Migrate(context.Background(), true)
+	if err != nil {
+		log.Fatalf("failed to read the migrations: %v", err)
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("The database is up to date")
+	}
+
+	for _, migration := range pending {
+		fmt.Printf("Pending migration %d_%s\n", migration.Version, migration.Name)
+	}
 }
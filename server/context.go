@@ -1,13 +1,16 @@
 package server
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+)
 
 type context struct {
 	*http.Request
 	http.ResponseWriter
 
 	responseHeader http.Header
-	requestHeader func() http.Header
+	requestHeader  func() http.Header
 }
 
 func newContext(w http.ResponseWriter, r *http.Request) *context {
@@ -19,6 +22,29 @@ func newContext(w http.ResponseWriter, r *http.Request) *context {
 	}
 }
 
+// apiError is the body sent back by the api endpoints when a request
+// cannot be handled.
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeJSON writes v as the JSON response body with the given status.
+func (c *context) writeJSON(status int, v any) {
+	c.ResponseWriter.Header().Set("Content-Type", "application/json")
+	c.WriteHeader(status)
+	_ = json.NewEncoder(c.ResponseWriter).Encode(v)
+}
+
+// writeError writes a structured apiError response.
+func (c *context) writeError(status int, code, message string) {
+	c.writeJSON(status, apiError{Error: apiErrorBody{Code: code, Message: message}})
+}
+
 type ctxHandler interface {
 	serveHTTP(*context)
 }
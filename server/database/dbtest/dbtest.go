@@ -0,0 +1,464 @@
+// Package dbtest is the behaviour every database.QueryHandler shares. Each
+// driver runs it from its own tests, so that they stay interchangeable.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+)
+
+// Open returns a handler which has been initialised and holds no logs. It
+// is called once for each test in the suite.
+type Open func(t *testing.T) database.QueryHandler
+
+// Run runs the conformance suite against the handlers returned by open.
+func Run(t *testing.T, open Open) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db database.QueryHandler)
+	}{
+		{"RoundTrip", testRoundTrip},
+		{"Filter", testFilter},
+		{"Query", testQuery},
+		{"Count", testCount},
+		{"Attributes", testAttributes},
+		{"Trace", testTrace},
+		{"Duplicates", testDuplicates},
+		{"InvalidFilter", testInvalidFilter},
+		{"WriteLogs", testWriteLogs},
+		{"WriteLog", testWriteLog},
+		{"Cancelled", testCancelled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, open(t))
+		})
+	}
+}
+
+var base = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testLogs returns info, warn and error logs received a microsecond apart,
+// from the api source. Only the warn log has a group.
+func testLogs() []*core.Log {
+	source := "api"
+	group := "request-1"
+
+	var logs []*core.Log
+	for i, level := range []core.Level{core.INFO, core.WARN, core.ERROR} {
+		receivedAt := base.Add(time.Duration(i) * time.Microsecond)
+		logs = append(logs, &core.Log{
+			Level:      level,
+			Source:     &source,
+			Message:    level.String(),
+			RecordedAt: base,
+			ReceivedAt: &receivedAt,
+		})
+	}
+
+	logs[1].Group = &group
+	logs[1].IsMessageJson = true
+
+	return logs
+}
+
+func write(t *testing.T, db database.QueryHandler, logs []*core.Log) {
+	t.Helper()
+
+	if err := db.WriteLogs(t.Context(), logs); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+}
+
+// ReadAll reads every log selected by the query.
+func ReadAll(t *testing.T, db database.QueryHandler, query *database.Query) []*core.Log {
+	t.Helper()
+
+	it, err := db.GetLogs(t.Context(), query)
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	defer it.Close()
+
+	var out []*core.Log
+	for it.Next() {
+		out = append(out, it.Log())
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatalf("failed to read logs: %v", err)
+	}
+
+	return out
+}
+
+func messages(logs []*core.Log) []string {
+	var out []string
+	for _, log := range logs {
+		out = append(out, log.Message)
+	}
+	return out
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testRoundTrip(t *testing.T, db database.QueryHandler) {
+	logs := testLogs()
+	write(t, db, logs)
+
+	// Every field is read back as it was written
+	all := ReadAll(t, db, nil)
+	if len(all) != len(logs) {
+		t.Fatalf("expected %d logs, got %d", len(logs), len(all))
+	}
+
+	for i, log := range all {
+		if log.Level != logs[i].Level || log.Message != logs[i].Message || log.Source == nil ||
+			*log.Source != *logs[i].Source || log.IsMessageJson != logs[i].IsMessageJson ||
+			!log.RecordedAt.Equal(base) || log.ReceivedAt == nil || !log.ReceivedAt.Equal(*logs[i].ReceivedAt) {
+			t.Errorf("log %d was not read back as written: %+v", i, log)
+		}
+	}
+
+	if all[0].Group != nil || all[1].Group == nil || *all[1].Group != *logs[1].Group {
+		t.Error("expected only the second log to have a group")
+	}
+
+	// The logs read are not the ones written
+	all[0].Message = "changed"
+	if got := ReadAll(t, db, nil); got[0].Message != "info" {
+		t.Error("expected a read log to be a copy")
+	}
+}
+
+func testFilter(t *testing.T, db database.QueryHandler) {
+	logs := testLogs()
+	write(t, db, logs)
+
+	tests := []struct {
+		name     string
+		filter   *database.Filter
+		expected []string
+	}{
+		{"empty", &database.Filter{}, []string{"info", "warn", "error"}},
+		{"level", &database.Filter{Level: database.NewLevelFilter(ptr(core.WARN))}, []string{"warn"}},
+		{"level range", &database.Filter{Level: &database.FieldFilter[core.Level]{Ge: ptr(core.WARN)}}, []string{"warn", "error"}},
+		{"received at", &database.Filter{ReceivedAt: database.NewTimeFilter(nil, logs[1].ReceivedAt, nil)}, []string{"info", "warn"}},
+		{"received at eq", &database.Filter{ReceivedAt: database.NewTimeFilter(logs[2].ReceivedAt, nil, nil)}, []string{"error"}},
+		{"message", &database.Filter{Message: database.NewStringFilter(ptr("^(info|error)$"))}, []string{"info", "error"}},
+		{"source", &database.Filter{Source: database.NewStringFilter(ptr("ap"))}, []string{"info", "warn", "error"}},
+		{"group", &database.Filter{Group: database.NewStringFilter(ptr("request"))}, []string{"warn"}},
+		{"no match", &database.Filter{Source: database.NewStringFilter(ptr("worker"))}, nil},
+		{
+			"every field",
+			&database.Filter{
+				Level:      &database.FieldFilter[core.Level]{Le: ptr(core.WARN)},
+				Source:     database.NewStringFilter(ptr("api")),
+				Group:      database.NewStringFilter(ptr("1")),
+				Message:    database.NewStringFilter(ptr("w")),
+				ReceivedAt: database.NewTimeFilter(nil, nil, &base),
+			},
+			[]string{"warn"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := messages(ReadAll(t, db, &database.Query{Filter: test.filter})); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func testQuery(t *testing.T, db database.QueryHandler) {
+	logs := testLogs()
+
+	// The logs are read in order of ReceivedAt, not of writing
+	write(t, db, []*core.Log{logs[2], logs[0], logs[1]})
+
+	tests := []struct {
+		name     string
+		query    *database.Query
+		expected []string
+	}{
+		{"nil", nil, []string{"info", "warn", "error"}},
+		{"ascending", &database.Query{}, []string{"info", "warn", "error"}},
+		{"descending", &database.Query{Order: database.Descending}, []string{"error", "warn", "info"}},
+		{"limit", &database.Query{Order: database.Descending, Limit: 2}, []string{"error", "warn"}},
+		{"cursor", &database.Query{Cursor: logs[0].ReceivedAt}, []string{"warn", "error"}},
+		{"descending cursor", &database.Query{Order: database.Descending, Cursor: logs[2].ReceivedAt, Limit: 1}, []string{"warn"}},
+		{"cursor at the end", &database.Query{Cursor: logs[2].ReceivedAt}, nil},
+		{
+			"cursor and filter",
+			&database.Query{Filter: &database.Filter{Level: database.NewLevelFilter(ptr(core.INFO))}, Cursor: logs[0].ReceivedAt},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := messages(ReadAll(t, db, test.query)); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func testCount(t *testing.T, db database.QueryHandler) {
+	logs := testLogs()
+	write(t, db, logs)
+
+	tests := []struct {
+		name     string
+		query    *database.Query
+		expected uint64
+	}{
+		{"nil", nil, 3},
+		{"filter", &database.Query{Filter: &database.Filter{Level: &database.FieldFilter[core.Level]{Ge: ptr(core.WARN)}}}, 2},
+		{"limit is ignored", &database.Query{Limit: 1}, 3},
+		{"cursor", &database.Query{Cursor: logs[0].ReceivedAt}, 2},
+		{"descending cursor", &database.Query{Order: database.Descending, Cursor: logs[2].ReceivedAt}, 2},
+		{"no match", &database.Query{Filter: &database.Filter{Source: database.NewStringFilter(ptr("worker"))}}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := db.CountLogs(t.Context(), test.query); err != nil || got != test.expected {
+				t.Errorf("expected %d, got %d %v", test.expected, got, err)
+			}
+		})
+	}
+
+	invalid := &database.Query{Filter: &database.Filter{Message: database.NewStringFilter(ptr("("))}}
+	if _, err := db.CountLogs(t.Context(), invalid); err == nil {
+		t.Error("expected an invalid filter to be rejected")
+	}
+}
+
+func testAttributes(t *testing.T, db database.QueryHandler) {
+	logs := testLogs()
+	logs[0].Attributes = map[string]any{"status": 200, "path": "/users", "cached": nil}
+	logs[1].Attributes = map[string]any{"status": 500.0, "req": map[string]any{"id": "1"}, "html": "<b>"}
+	write(t, db, logs)
+
+	// Attributes are read back as encoding/json decodes them
+	all := ReadAll(t, db, nil)
+	expected := []map[string]any{
+		{"status": float64(200), "path": "/users", "cached": nil},
+		{"status": float64(500), "req": map[string]any{"id": "1"}, "html": "<b>"},
+		nil,
+	}
+
+	for i, log := range all {
+		if !reflect.DeepEqual(log.Attributes, expected[i]) {
+			t.Errorf("log %d: expected attributes %v, got %v", i, expected[i], log.Attributes)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		attrs    []database.AttributeFilter
+		expected []string
+	}{
+		{"key", []database.AttributeFilter{{Key: "status"}}, []string{"info", "warn"}},
+		{"null value", []database.AttributeFilter{{Key: "cached"}}, []string{"info"}},
+		{"missing key", []database.AttributeFilter{{Key: "user"}}, nil},
+		{"number", []database.AttributeFilter{{Key: "status", Value: 500}}, []string{"warn"}},
+		{"number as string", []database.AttributeFilter{{Key: "status", Value: "500"}}, nil},
+		{"string", []database.AttributeFilter{{Key: "path", Value: "/users"}}, []string{"info"}},
+		{"html", []database.AttributeFilter{{Key: "html", Value: "<b>"}}, []string{"warn"}},
+		{"object", []database.AttributeFilter{{Key: "req", Value: map[string]any{"id": "1"}}}, []string{"warn"}},
+		{"every attribute", []database.AttributeFilter{{Key: "status", Value: 200}, {Key: "req"}}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := &database.Query{Filter: &database.Filter{Attributes: test.attrs}}
+			if got := messages(ReadAll(t, db, query)); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+
+	// Attributes which cannot be encoded fail only their own log
+	receivedAt := base.Add(time.Hour)
+	err := db.WriteLogs(t.Context(), []*core.Log{
+		{Message: "bad", ReceivedAt: &receivedAt, Attributes: map[string]any{"f": func() {}}},
+		{Message: "good", ReceivedAt: &receivedAt},
+	})
+
+	var batchErr *database.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 1 || batchErr.Failed[0] == nil {
+		t.Errorf("expected only the first log to fail, got %v", err)
+	}
+}
+
+func testTrace(t *testing.T, db database.QueryHandler) {
+	trace := "4bf92f3577b34da6a3ce929d0e0e4736"
+	other := "0af7651916cd43dd8448eb211c80319c"
+
+	logs := testLogs()
+	logs[0].TraceID, logs[0].SpanID = &trace, ptr("00f067aa0ba902b7")
+	logs[1].TraceID, logs[1].SpanID = &other, ptr("b7ad6b7169203331")
+	logs[2].TraceID, logs[2].SpanID = &trace, ptr("b7ad6b7169203331")
+	write(t, db, append(logs, &core.Log{Message: "untraced", ReceivedAt: ptr(base.Add(time.Hour))}))
+
+	all := ReadAll(t, db, nil)
+	if all[0].TraceID == nil || *all[0].TraceID != trace || all[0].SpanID == nil || *all[0].SpanID != "00f067aa0ba902b7" {
+		t.Errorf("expected the trace context to be read back, got %v/%v", all[0].TraceID, all[0].SpanID)
+	}
+
+	if all[3].TraceID != nil || all[3].SpanID != nil {
+		t.Error("expected a log without a trace to have no trace context")
+	}
+
+	tests := []struct {
+		name     string
+		filter   *database.Filter
+		expected []string
+	}{
+		{"trace", &database.Filter{TraceID: database.NewStringFilter(&trace)}, []string{"info", "error"}},
+		{"span", &database.Filter{SpanID: database.NewStringFilter(ptr("b7ad6b7169203331"))}, []string{"warn", "error"}},
+		{
+			"trace and span",
+			&database.Filter{TraceID: database.NewStringFilter(&trace), SpanID: database.NewStringFilter(ptr("b7ad6b7169203331"))},
+			[]string{"error"},
+		},
+		{"prefix", &database.Filter{TraceID: database.NewStringFilter(ptr(trace[:8]))}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := messages(ReadAll(t, db, &database.Query{Filter: test.filter})); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func testDuplicates(t *testing.T, db database.QueryHandler) {
+	logs := testLogs()
+	for _, log := range logs {
+		log.ID = core.NewID()
+	}
+
+	// A copy of the first log in the same batch is skipped
+	first := *logs[0]
+	write(t, db, append(logs, &first))
+
+	all := ReadAll(t, db, nil)
+	if len(all) != len(logs) {
+		t.Fatalf("expected %d logs, got %d", len(logs), len(all))
+	}
+
+	for i, log := range all {
+		if log.ID != logs[i].ID {
+			t.Errorf("log %d: expected ID %q, got %q", i, logs[i].ID, log.ID)
+		}
+	}
+
+	// Writing them again succeeds without storing a copy, whether in a
+	// batch or on their own, while a new log is still written
+	receivedAt := base.Add(time.Hour)
+	write(t, db, append(logs, &core.Log{ID: core.NewID(), Message: "new", ReceivedAt: &receivedAt}))
+
+	if err := db.WriteLog(logs[1]); err != nil {
+		t.Errorf("expected writing a stored log to succeed, got %v", err)
+	}
+
+	// Logs without an ID are never duplicates
+	write(t, db, []*core.Log{{Message: "untracked", ReceivedAt: &receivedAt}, {Message: "untracked", ReceivedAt: &receivedAt}})
+
+	expected := []string{"info", "warn", "error", "new", "untracked", "untracked"}
+	if got := messages(ReadAll(t, db, nil)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func testInvalidFilter(t *testing.T, db database.QueryHandler) {
+	filters := map[string]*database.Filter{
+		"regex":     {Message: database.NewStringFilter(ptr("("))},
+		"source le": {Source: &database.FieldFilter[string]{Le: ptr("api")}},
+		"trace le":  {TraceID: &database.FieldFilter[string]{Le: ptr("a")}},
+		"attribute": {Attributes: []database.AttributeFilter{{Key: `a"b`}}},
+	}
+
+	for name, filter := range filters {
+		if _, err := db.GetLogs(t.Context(), &database.Query{Filter: filter}); err == nil {
+			t.Errorf("%s: expected the filter to be rejected", name)
+		}
+	}
+}
+
+func testWriteLogs(t *testing.T, db database.QueryHandler) {
+	var logs []*core.Log
+	for i := range 10 {
+		receivedAt := base.Add(time.Duration(i) * time.Microsecond)
+		logs = append(logs, &core.Log{Level: core.INFO, Message: fmt.Sprint(i), ReceivedAt: &receivedAt})
+	}
+
+	logs[3] = nil
+	logs[7].ReceivedAt = nil
+
+	err := db.WriteLogs(t.Context(), logs)
+
+	var batchErr *database.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+
+	if len(batchErr.Failed) != 2 || batchErr.Failed[3] == nil || batchErr.Failed[7] == nil {
+		t.Errorf("expected logs 3 and 7 to fail, got %v", batchErr.Failed)
+	}
+
+	// Every other log is kept
+	expected := []string{"0", "1", "2", "4", "5", "6", "8", "9"}
+	if got := messages(ReadAll(t, db, nil)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if err := db.WriteLogs(t.Context(), nil); err != nil {
+		t.Errorf("expected an empty batch to succeed, got %v", err)
+	}
+}
+
+func testWriteLog(t *testing.T, db database.QueryHandler) {
+	logs := testLogs()
+	for _, log := range logs {
+		if err := db.WriteLog(log); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	if got := messages(ReadAll(t, db, nil)); !reflect.DeepEqual(got, []string{"info", "warn", "error"}) {
+		t.Errorf("unexpected logs %v", got)
+	}
+
+	// A single log reports its own error
+	var batchErr *database.BatchError
+	if err := db.WriteLog(&core.Log{}); err == nil || errors.As(err, &batchErr) {
+		t.Errorf("expected the log's own error, got %v", err)
+	}
+}
+
+func testCancelled(t *testing.T, db database.QueryHandler) {
+	write(t, db, testLogs())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := db.GetLogs(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled query to fail, got %v", err)
+	}
+}
@@ -1,11 +1,90 @@
 package database
 
-import "github.com/m4tth3/loggui/core"
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/m4tth3/loggui/core"
+)
 
 // QueryHandler is an interface to abstract operations across
 // different databases.
 type QueryHandler interface {
 	Init() error
-	GetLogs(filter *Filter) (chan *core.Log, error)
+
+	// GetLogs starts reading the logs selected by the query. The query is
+	// stopped once ctx is done, after which the iterator returns ctx.Err().
+	GetLogs(ctx context.Context, query *Query) (LogIterator, error)
+
+	// CountLogs counts the logs GetLogs would read for the query, ignoring
+	// its Limit, without reading them.
+	CountLogs(ctx context.Context, query *Query) (uint64, error)
+
 	WriteLog(log *core.Log) error
+
+	// WriteLogs writes a batch of logs. If only some of them could not be
+	// written the others are kept, and a *BatchError says which failed. Any
+	// other error means none were written.
+	WriteLogs(ctx context.Context, logs []*core.Log) error
+}
+
+// BatchError reports the logs of a batch which could not be written.
+type BatchError struct {
+	// Failed maps the index of each log which was not written to its error
+	Failed map[int]error
+}
+
+func (e *BatchError) Error() string {
+	indexes := e.indexes()
+	if len(indexes) == 0 {
+		return "no logs failed to be written"
+	}
+
+	first := indexes[0]
+	return fmt.Sprintf("failed to write %d logs, log %d: %v", len(indexes), first, e.Failed[first])
+}
+
+// Unwrap returns the errors in the order of the logs.
+func (e *BatchError) Unwrap() []error {
+	var errs []error
+	for _, i := range e.indexes() {
+		errs = append(errs, e.Failed[i])
+	}
+
+	return errs
+}
+
+func (e *BatchError) indexes() []int {
+	indexes := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	return indexes
+}
+
+// WriteEach writes the logs one at a time with write, for handlers which
+// have no faster way to write a batch. It stops early if ctx is done, in
+// which case ctx.Err() is returned for the logs which were not attempted.
+func WriteEach(ctx context.Context, logs []*core.Log, write func(log *core.Log) error) error {
+	failed := map[int]error{}
+
+	for i, log := range logs {
+		if err := ctx.Err(); err != nil {
+			failed[i] = err
+			continue
+		}
+
+		if err := write(log); err != nil {
+			failed[i] = err
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &BatchError{Failed: failed}
 }
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+func TestWriteEach(t *testing.T) {
+	logs := []*core.Log{{Message: "1"}, {Message: "2"}, {Message: "3"}}
+	rejected := errors.New("rejected")
+
+	var written []string
+	err := WriteEach(context.Background(), logs, func(log *core.Log) error {
+		if log.Message == "2" {
+			return rejected
+		}
+
+		written = append(written, log.Message)
+		return nil
+	})
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+
+	if len(batchErr.Failed) != 1 || batchErr.Failed[1] != rejected {
+		t.Errorf("expected only log 1 to fail, got %v", batchErr.Failed)
+	}
+
+	if len(written) != 2 {
+		t.Errorf("expected the other logs to be written, got %v", written)
+	}
+
+	if !errors.Is(err, rejected) {
+		t.Error("expected the batch error to wrap the log's error")
+	}
+
+	if err := WriteEach(context.Background(), logs, func(*core.Log) error { return nil }); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestWriteEach_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := WriteEach(ctx, []*core.Log{{}, {}}, func(*core.Log) error {
+		t.Error("expected no log to be written")
+		return nil
+	})
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 2 || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected every log to fail with the context's error, got %v", err)
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	err := &BatchError{Failed: map[int]error{
+		4: errors.New("second"),
+		2: errors.New("first"),
+	}}
+
+	if expected := "failed to write 2 logs, log 2: first"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+
+	unwrapped := err.Unwrap()
+	if len(unwrapped) != 2 || unwrapped[0].Error() != "first" || unwrapped[1].Error() != "second" {
+		t.Errorf("expected the errors in order, got %v", unwrapped)
+	}
+}
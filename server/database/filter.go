@@ -1,6 +1,9 @@
 package database
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/m4tth3/loggui/core"
 	"regexp"
 	"strings"
@@ -49,16 +52,36 @@ func NewTimeFilter(eq, le, ge *time.Time) *FieldFilter[time.Time] {
 	return &FieldFilter[time.Time]{Eq: eq, Le: le, Ge: ge}
 }
 
+// AttributeFilter matches logs with the attribute Key. If Value is set the
+// attribute must also equal it. Values are compared as JSON, so 200 matches
+// 200.0 but not "200".
+type AttributeFilter struct {
+	Key   string
+	Value any
+}
+
+func (f AttributeFilter) Equal(other AttributeFilter) bool {
+	return f.Key == other.Key && jsonEqual(f.Value, other.Value)
+}
+
 type Filter struct {
 	Level      *FieldFilter[core.Level]
 	Source     *FieldFilter[string]
 	Group      *FieldFilter[string]
 	Message    *FieldFilter[string]
 	ReceivedAt *FieldFilter[time.Time]
+
+	// Attributes must all match
+	Attributes []AttributeFilter
+
+	// TraceID and SpanID match exactly, unlike Source and Group
+	TraceID *FieldFilter[string]
+	SpanID  *FieldFilter[string]
 }
 
 func (f *Filter) IsEmpty() bool {
-	return f.Level == nil && f.Source == nil && f.Group == nil && f.Message == nil && f.ReceivedAt == nil
+	return f.Level == nil && f.Source == nil && f.Group == nil && f.Message == nil && f.ReceivedAt == nil &&
+		len(f.Attributes) == 0 && f.TraceID == nil && f.SpanID == nil
 }
 
 func (f *Filter) Equal(other *Filter) bool {
@@ -72,17 +95,26 @@ func (f *Filter) Equal(other *Filter) bool {
 		f.Group.Equal(other.Group),
 		f.Message.Equal(other.Message),
 		f.ReceivedAt.Equal(other.ReceivedAt),
+		f.TraceID.Equal(other.TraceID),
+		f.SpanID.Equal(other.SpanID),
+		len(f.Attributes) == len(other.Attributes),
 	) {
 		return false
 	}
 
+	for i, attr := range f.Attributes {
+		if !attr.Equal(other.Attributes[i]) {
+			return false
+		}
+	}
+
 	return true
 }
 
 func (f *Filter) Filter(log *core.Log) bool {
 	if !isValid(
 		ifField(f.Level, func() bool {
-			return *f.Level.Eq == log.Level
+			return inRange(log.Level, f.Level, func(a, b core.Level) int { return int(a - b) })
 		}),
 		ifField(f.Source, log.Source, func() bool {
 			return strings.Contains(*log.Source, *f.Source.Eq)
@@ -99,27 +131,96 @@ func (f *Filter) Filter(log *core.Log) bool {
 			return ok
 		}),
 		ifField(f.ReceivedAt, log.ReceivedAt, func() bool {
-			switch {
-			case f.ReceivedAt.Eq != nil:
-				return log.RecordedAt.Equal(*f.ReceivedAt.Eq)
-			case f.ReceivedAt.Le != nil && f.ReceivedAt.Ge != nil:
-				return (log.RecordedAt.Before(*f.ReceivedAt.Le) || log.RecordedAt.Equal(*f.ReceivedAt.Le)) &&
-					(log.RecordedAt.After(*f.ReceivedAt.Ge) || log.RecordedAt.Equal(*f.ReceivedAt.Ge))
-			case f.ReceivedAt.Le != nil:
-				return log.RecordedAt.Before(*f.ReceivedAt.Le) || log.RecordedAt.Equal(*f.ReceivedAt.Le)
-			case f.ReceivedAt.Ge != nil:
-				return log.RecordedAt.After(*f.ReceivedAt.Ge) || log.RecordedAt.Equal(*f.ReceivedAt.Ge)
-			default:
-				panic("ReceivedAt filter is not set")
-			}
+			return inRange(*log.ReceivedAt, f.ReceivedAt, time.Time.Compare)
+		}),
+		ifField(f.TraceID, log.TraceID, func() bool {
+			return *log.TraceID == *f.TraceID.Eq
+		}),
+		ifField(f.SpanID, log.SpanID, func() bool {
+			return *log.SpanID == *f.SpanID.Eq
 		}),
 	) {
 		return false
 	}
 
+	for _, attr := range f.Attributes {
+		value, ok := log.Attributes[attr.Key]
+		if !ok || (attr.Value != nil && !jsonEqual(value, attr.Value)) {
+			return false
+		}
+	}
+
 	return true
 }
 
+// Validate checks the filter can be applied. Filter panics on a filter
+// which does not pass.
+func (f *Filter) Validate() error {
+	for name, field := range map[string]*FieldFilter[string]{
+		"source":   f.Source,
+		"group":    f.Group,
+		"message":  f.Message,
+		"trace ID": f.TraceID,
+		"span ID":  f.SpanID,
+	} {
+		if field != nil && field.Eq == nil {
+			return fmt.Errorf("%s filter only supports Eq", name)
+		}
+	}
+
+	if f.Message != nil {
+		if _, err := regexp.Compile(*f.Message.Eq); err != nil {
+			return fmt.Errorf("invalid message regex: %w", err)
+		}
+	}
+
+	for _, attr := range f.Attributes {
+		// Keys are quoted into JSON paths by some drivers
+		if attr.Key == "" || strings.ContainsAny(attr.Key, `"\`) {
+			return fmt.Errorf("invalid attribute key %q", attr.Key)
+		}
+
+		if _, err := EncodeJSON(attr.Value); err != nil {
+			return fmt.Errorf("invalid value for attribute %s: %w", attr.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// EncodeJSON encodes attributes as they are stored, so that drivers can
+// compare them as text. Unlike json.Marshal, HTML characters are not
+// escaped.
+func EncodeJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// jsonEqual checks the values encode to the same JSON.
+func jsonEqual(a, b any) bool {
+	encodedA, errA := EncodeJSON(a)
+	encodedB, errB := EncodeJSON(b)
+
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// inRange checks the value against every bound set on the filter. All of
+// the bounds are inclusive.
+func inRange[T comparable](value T, f *FieldFilter[T], cmp func(a, b T) int) bool {
+	return isValid(
+		f.Eq == nil || cmp(value, *f.Eq) == 0,
+		f.Le == nil || cmp(value, *f.Le) <= 0,
+		f.Ge == nil || cmp(value, *f.Ge) >= 0,
+	)
+}
+
 func compare[T comparable](a, b *T) bool {
 	if a == nil && b == nil {
 		return true
@@ -302,6 +302,18 @@ func TestFilter_Equal_AllParams(t *testing.T) {
 			f2:   &Filter{ReceivedAt: NewTimeFilter(nil, nil, &after)},
 			want: false,
 		},
+		{
+			name: "different trace ID",
+			f1:   &Filter{TraceID: NewStringFilter(&source)},
+			f2:   &Filter{TraceID: NewStringFilter(&source2)},
+			want: false,
+		},
+		{
+			name: "different span ID",
+			f1:   &Filter{SpanID: NewStringFilter(&source)},
+			f2:   &Filter{},
+			want: false,
+		},
 		{
 			name: "all nil fields",
 			f1:   &Filter{},
@@ -325,3 +337,151 @@ func TestFilter_Equal_AllParams(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_FilterReceivedAt(t *testing.T) {
+	receivedAt := time.Now()
+	log := &core.Log{
+		Level:      core.WARN,
+		RecordedAt: receivedAt.Add(-time.Hour),
+		ReceivedAt: &receivedAt,
+	}
+
+	// The filter applies to ReceivedAt, not the time the log was recorded
+	after := receivedAt.Add(-time.Minute)
+	if !(&Filter{ReceivedAt: NewTimeFilter(nil, nil, &after)}).Filter(log) {
+		t.Errorf("expected log received after %v to match", after)
+	}
+
+	info, err := core.INFO, core.ERROR
+	if !(&Filter{Level: &FieldFilter[core.Level]{Ge: &info, Le: &err}}).Filter(log) {
+		t.Errorf("expected WARN to be within INFO..ERROR")
+	}
+
+	if (&Filter{Level: &FieldFilter[core.Level]{Ge: &err}}).Filter(log) {
+		t.Errorf("expected WARN to be below ERROR")
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	valid := "^hello"
+	invalid := "(hello"
+
+	if err := (&Filter{Message: NewStringFilter(&valid)}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if err := (&Filter{Message: NewStringFilter(&invalid)}).Validate(); err == nil {
+		t.Errorf("expected an error for an invalid regex")
+	}
+
+	if err := (&Filter{Source: &FieldFilter[string]{}}).Validate(); err == nil {
+		t.Errorf("expected an error for a source filter without Eq")
+	}
+}
+
+func TestFilter_FilterAttributes(t *testing.T) {
+	log := &core.Log{
+		Message: "request served",
+		Attributes: map[string]any{
+			"status": float64(200),
+			"path":   "/users",
+			"req":    map[string]any{"id": "1"},
+			"cached": nil,
+		},
+	}
+
+	tests := []struct {
+		name  string
+		attrs []AttributeFilter
+		want  bool
+	}{
+		{"key", []AttributeFilter{{Key: "status"}}, true},
+		{"null value", []AttributeFilter{{Key: "cached"}}, true},
+		{"missing key", []AttributeFilter{{Key: "user"}}, false},
+		{"number", []AttributeFilter{{Key: "status", Value: 200}}, true},
+		{"number as string", []AttributeFilter{{Key: "status", Value: "200"}}, false},
+		{"string", []AttributeFilter{{Key: "path", Value: "/users"}}, true},
+		{"object", []AttributeFilter{{Key: "req", Value: map[string]any{"id": "1"}}}, true},
+		{"every attribute", []AttributeFilter{{Key: "status", Value: 200}, {Key: "path", Value: "/"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (&Filter{Attributes: test.attrs}).Filter(log); got != test.want {
+				t.Errorf("Filter() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if (&Filter{Attributes: []AttributeFilter{{Key: "status"}}}).Filter(&core.Log{}) {
+		t.Error("expected a log without attributes not to match")
+	}
+}
+
+func TestFilter_EqualAttributes(t *testing.T) {
+	a := &Filter{Attributes: []AttributeFilter{{Key: "status", Value: 200}}}
+
+	if !a.Equal(&Filter{Attributes: []AttributeFilter{{Key: "status", Value: float64(200)}}}) {
+		t.Error("expected filters with the same attribute to be equal")
+	}
+
+	for _, other := range []*Filter{
+		{},
+		{Attributes: []AttributeFilter{{Key: "status"}}},
+		{Attributes: []AttributeFilter{{Key: "status", Value: "200"}}},
+		{Attributes: []AttributeFilter{{Key: "status", Value: 200}, {Key: "path"}}},
+	} {
+		if a.Equal(other) {
+			t.Errorf("expected %v to differ", other.Attributes)
+		}
+	}
+
+	if a.IsEmpty() {
+		t.Error("expected an attribute filter not to be empty")
+	}
+}
+
+func TestFilter_ValidateAttributes(t *testing.T) {
+	for _, attr := range []AttributeFilter{
+		{Key: ""},
+		{Key: `a"b`},
+		{Key: "ok", Value: func() {}},
+	} {
+		if err := (&Filter{Attributes: []AttributeFilter{attr}}).Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", attr)
+		}
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	encoded, err := EncodeJSON(map[string]any{"b": "<a>", "a": 1.0})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(encoded) != `{"a":1,"b":"<a>"}` {
+		t.Errorf("unexpected encoding %s", encoded)
+	}
+}
+
+func TestFilter_FilterTrace(t *testing.T) {
+	trace, span := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	log := &core.Log{TraceID: &trace, SpanID: &span}
+
+	if !(&Filter{TraceID: NewStringFilter(&trace), SpanID: NewStringFilter(&span)}).Filter(log) {
+		t.Error("expected the log to match its trace and span")
+	}
+
+	prefix := trace[:8]
+	if (&Filter{TraceID: NewStringFilter(&prefix)}).Filter(log) {
+		t.Error("expected trace IDs to match exactly")
+	}
+
+	if (&Filter{TraceID: NewStringFilter(&trace)}).Filter(&core.Log{}) {
+		t.Error("expected a log without a trace not to match")
+	}
+
+	if (&Filter{TraceID: NewStringFilter(&trace)}).IsEmpty() {
+		t.Error("expected a trace filter not to be empty")
+	}
+}
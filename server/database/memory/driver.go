@@ -0,0 +1,333 @@
+// Package memory is a database which keeps the logs in memory, for tests
+// and for running loggui without one. The logs are lost when it stops.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	d "github.com/m4tth3/loggui/server/database"
+)
+
+// DefaultMaxSize is the most logs kept when Config.MaxSize is not set
+const DefaultMaxSize = 1_000_000
+
+// Config configures the logs kept in memory.
+type Config struct {
+	// MaxSize is the most logs kept. The oldest are dropped to make room.
+	MaxSize int
+
+	// MaxAge is how long after it is received a log is kept. Zero keeps
+	// logs until they are dropped for MaxSize.
+	MaxAge time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxSize <= 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+	if c.MaxAge < 0 {
+		c.MaxAge = 0
+	}
+
+	return c
+}
+
+// driver keeps the logs in a slice ordered by ReceivedAt, so that a query
+// finds where its cursor starts with a binary search, and the oldest logs
+// are dropped from the front. ids holds the IDs of the logs kept, so that
+// a log written again is only kept once.
+//
+// Implements d.QueryHandler
+type driver struct {
+	config Config
+	now    func() time.Time
+
+	mu   sync.Mutex
+	logs []*core.Log
+	ids  map[string]struct{}
+}
+
+// NewQueryHandler returns an empty in-memory database.
+func NewQueryHandler(config Config) d.QueryHandler {
+	return &driver{config: config.withDefaults(), now: time.Now, ids: map[string]struct{}{}}
+}
+
+// Init does nothing, as there is no schema.
+func (dr *driver) Init() error {
+	return nil
+}
+
+func (dr *driver) GetLogs(ctx context.Context, query *d.Query) (d.LogIterator, error) {
+	if query == nil {
+		query = &d.Query{}
+	}
+
+	filter := query.Filter
+	if filter == nil {
+		filter = &d.Filter{}
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	dr.expire()
+
+	// The logs are copied while locked, so that later writes do not change
+	// what the iterator reads
+	i, step := dr.search(query), 1
+	if query.Order == d.Descending {
+		i, step = i-1, -1
+	}
+
+	var logs []*core.Log
+	for ; i >= 0 && i < len(dr.logs); i += step {
+		if query.Limit > 0 && len(logs) == query.Limit {
+			break
+		}
+
+		if filter.Filter(dr.logs[i]) {
+			// The attributes were decoded on write, so they decode again
+			log, _ := copyLog(dr.logs[i])
+			logs = append(logs, log)
+		}
+	}
+
+	return &iterator{ctx: ctx, logs: d.NewSliceIterator(logs)}, nil
+}
+
+// CountLogs counts the logs GetLogs would read, without copying them.
+func (dr *driver) CountLogs(ctx context.Context, query *d.Query) (uint64, error) {
+	if query == nil {
+		query = &d.Query{}
+	}
+
+	filter := query.Filter
+	if filter == nil {
+		filter = &d.Filter{}
+	}
+
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	dr.expire()
+
+	logs := dr.logs[dr.search(query):]
+	if query.Order == d.Descending {
+		logs = dr.logs[:dr.search(query)]
+	}
+
+	var count uint64
+	for _, log := range logs {
+		if filter.Filter(log) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// search returns the index of the first log after the cursor of an
+// ascending query, or one past the last log before the cursor of a
+// descending one.
+func (dr *driver) search(query *d.Query) int {
+	switch {
+	case query.Cursor == nil && query.Order == d.Descending:
+		return len(dr.logs)
+	case query.Cursor == nil:
+		return 0
+	case query.Order == d.Descending:
+		return sort.Search(len(dr.logs), func(i int) bool {
+			return !dr.logs[i].ReceivedAt.Before(*query.Cursor)
+		})
+	default:
+		return sort.Search(len(dr.logs), func(i int) bool {
+			return dr.logs[i].ReceivedAt.After(*query.Cursor)
+		})
+	}
+}
+
+func (dr *driver) WriteLog(log *core.Log) error {
+	err := dr.WriteLogs(context.Background(), []*core.Log{log})
+
+	var batchErr *d.BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Failed[0]
+	}
+
+	return err
+}
+
+// WriteLogs keeps a copy of each log. A log with the ID of one already kept
+// is skipped, as the SQL drivers skip it.
+func (dr *driver) WriteLogs(ctx context.Context, logs []*core.Log) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	failed := map[int]error{}
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	for i, log := range logs {
+		if err := validateLog(log); err != nil {
+			failed[i] = err
+			continue
+		}
+
+		if _, ok := dr.ids[log.ID]; ok {
+			continue
+		}
+
+		c, err := copyLog(log)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+
+		dr.insert(c)
+	}
+
+	dr.expire()
+
+	if len(failed) > 0 {
+		return &d.BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// insert adds the log after every log received at or before it. Logs
+// mostly arrive in order, so it is usually appended.
+func (dr *driver) insert(log *core.Log) {
+	if log.ID != "" {
+		dr.ids[log.ID] = struct{}{}
+	}
+
+	n := len(dr.logs)
+	if n == 0 || !log.ReceivedAt.Before(*dr.logs[n-1].ReceivedAt) {
+		dr.logs = append(dr.logs, log)
+		return
+	}
+
+	i := sort.Search(n, func(i int) bool {
+		return dr.logs[i].ReceivedAt.After(*log.ReceivedAt)
+	})
+
+	dr.logs = slices.Insert(dr.logs, i, log)
+}
+
+// expire drops the logs which are past MaxAge, then the oldest logs over
+// MaxSize.
+func (dr *driver) expire() {
+	drop := 0
+
+	if dr.config.MaxAge > 0 {
+		oldest := dr.now().Add(-dr.config.MaxAge)
+		drop = sort.Search(len(dr.logs), func(i int) bool {
+			return !dr.logs[i].ReceivedAt.Before(oldest)
+		})
+	}
+
+	drop = max(drop, len(dr.logs)-dr.config.MaxSize)
+	if drop == 0 {
+		return
+	}
+
+	for _, log := range dr.logs[:drop] {
+		delete(dr.ids, log.ID)
+	}
+
+	// Clear the dropped logs so that they can be collected
+	clear(dr.logs[:drop])
+	dr.logs = dr.logs[drop:]
+}
+
+func validateLog(log *core.Log) error {
+	if log == nil {
+		return errors.New("log is nil")
+	}
+
+	if log.ReceivedAt == nil {
+		return errors.New("log has no ReceivedAt")
+	}
+
+	return nil
+}
+
+// copyLog copies the log as the SQL drivers store it: its times are cut to
+// microseconds, and its attributes are encoded as JSON and decoded again.
+func copyLog(log *core.Log) (*core.Log, error) {
+	c := *log
+	c.RecordedAt = log.RecordedAt.Truncate(time.Microsecond)
+
+	receivedAt := log.ReceivedAt.Truncate(time.Microsecond)
+	c.ReceivedAt = &receivedAt
+
+	c.Attributes = nil
+	if len(log.Attributes) > 0 {
+		encoded, err := d.EncodeJSON(log.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attributes: %w", err)
+		}
+
+		if err := json.Unmarshal(encoded, &c.Attributes); err != nil {
+			return nil, fmt.Errorf("failed to decode attributes: %w", err)
+		}
+	}
+
+	return &c, nil
+}
+
+// iterator reads the logs of a query until ctx is done.
+//
+// Implements d.LogIterator
+type iterator struct {
+	ctx  context.Context
+	logs d.LogIterator
+	err  error
+}
+
+func (it *iterator) Next() bool {
+	if it.err = it.ctx.Err(); it.err != nil {
+		return false
+	}
+
+	return it.logs.Next()
+}
+
+func (it *iterator) Log() *core.Log {
+	return it.logs.Log()
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Close() error {
+	return it.logs.Close()
+}
@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	d "github.com/m4tth3/loggui/server/database"
+	"github.com/m4tth3/loggui/server/database/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) d.QueryHandler {
+		return NewQueryHandler(Config{})
+	})
+}
+
+// testLogs returns n logs received a second apart from base, with their
+// index as the message.
+func testLogs(base time.Time, n int) []*core.Log {
+	var logs []*core.Log
+	for i := range n {
+		receivedAt := base.Add(time.Duration(i) * time.Second)
+		logs = append(logs, &core.Log{Level: core.INFO, Message: fmt.Sprint(i), ReceivedAt: &receivedAt})
+	}
+
+	return logs
+}
+
+func messages(t *testing.T, db d.QueryHandler) []string {
+	var out []string
+	for _, log := range dbtest.ReadAll(t, db, nil) {
+		out = append(out, log.Message)
+	}
+	return out
+}
+
+func TestDriver_MaxSize(t *testing.T) {
+	db := NewQueryHandler(Config{MaxSize: 3})
+
+	if err := db.WriteLogs(t.Context(), testLogs(time.Now(), 5)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	// The oldest logs make room for the newest
+	if got := messages(t, db); !reflect.DeepEqual(got, []string{"2", "3", "4"}) {
+		t.Errorf("expected the newest logs to be kept, got %v", got)
+	}
+}
+
+func TestDriver_DroppedID(t *testing.T) {
+	db := NewQueryHandler(Config{MaxSize: 1})
+	logs := testLogs(time.Now(), 2)
+	logs[0].ID = core.NewID()
+
+	if err := db.WriteLogs(t.Context(), logs); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	// The ID of a dropped log is forgotten along with it
+	again := *logs[0]
+	receivedAt := logs[1].ReceivedAt.Add(time.Second)
+	again.ReceivedAt = &receivedAt
+	if err := db.WriteLog(&again); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if got := messages(t, db); !reflect.DeepEqual(got, []string{"0"}) {
+		t.Errorf("expected the dropped log to be written again, got %v", got)
+	}
+}
+
+func TestDriver_MaxAge(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base.Add(3 * time.Second)
+
+	dr := NewQueryHandler(Config{MaxAge: 2 * time.Second}).(*driver)
+	dr.now = func() time.Time { return now }
+
+	if err := dr.WriteLogs(t.Context(), testLogs(base, 4)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if got := messages(t, dr); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("expected the logs within 2s to be kept, got %v", got)
+	}
+
+	// Logs expire on read as well as on write
+	now = now.Add(time.Second)
+	if got := messages(t, dr); !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Errorf("expected the logs within 2s to be kept, got %v", got)
+	}
+}
+
+func TestDriver_OutOfOrder(t *testing.T) {
+	db := NewQueryHandler(Config{})
+	logs := testLogs(time.Now(), 5)
+
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		if err := db.WriteLog(logs[i]); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	if got := messages(t, db); !reflect.DeepEqual(got, []string{"0", "1", "2", "3", "4"}) {
+		t.Errorf("expected the logs in order of ReceivedAt, got %v", got)
+	}
+
+	// Logs received at the same time are kept in the order written
+	same := &core.Log{Message: "same", ReceivedAt: logs[2].ReceivedAt}
+	if err := db.WriteLog(same); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if got := messages(t, db); !reflect.DeepEqual(got, []string{"0", "1", "2", "same", "3", "4"}) {
+		t.Errorf("expected the log after the one written first, got %v", got)
+	}
+}
+
+func TestDriver_Cancel(t *testing.T) {
+	db := NewQueryHandler(Config{})
+	if err := db.WriteLogs(t.Context(), testLogs(time.Now(), 3)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	it, err := db.GetLogs(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	defer it.Close()
+
+	if !it.Next() {
+		t.Fatalf("expected a log, got %v", it.Err())
+	}
+
+	// The iterator stops once ctx is done
+	cancel()
+	if it.Next() || !errors.Is(it.Err(), context.Canceled) {
+		t.Errorf("expected the iterator to stop, got %v", it.Err())
+	}
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are the SQL files which build up a driver's schema. They are
+// named <version>_<name>.sql, embedded in the driver, and applied in order
+// of version. Once applied a migration must not be changed, which is
+// checked with its checksum, so changes to the schema are made by adding a
+// new migration.
+
+// Migration is a single change to a schema.
+type Migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string
+}
+
+// MigrationTarget is a database the migrations are applied to. Drivers
+// implement it over a connection holding a lock, so that two instances
+// never migrate the same database at once.
+type MigrationTarget interface {
+	// Applied returns the checksum of every migration applied so far, by
+	// version.
+	Applied(ctx context.Context) (map[int]string, error)
+
+	// Apply runs the migration and records it, so that either both happen
+	// or neither does.
+	Apply(ctx context.Context, migration Migration) error
+}
+
+// Migrator is implemented by drivers with migrations.
+type Migrator interface {
+	// Migrate applies the pending migrations and returns them. With dryRun
+	// set they are only returned.
+	Migrate(ctx context.Context, dryRun bool) ([]Migration, error)
+}
+
+// LoadMigrations reads the migrations in dir, ordered by version.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	versions := map[int]string{}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".sql")
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		rawVersion, name, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(rawVersion)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>.sql", entry.Name())
+		}
+
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, entry.Name())
+		}
+		versions[version] = entry.Name()
+
+		sql, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		checksum := sha256.Sum256(sql)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     name,
+			SQL:      string(sql),
+			Checksum: hex.EncodeToString(checksum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies the migrations which have not been applied to the target
+// yet, in order, and returns them. With dryRun set nothing is applied, and
+// the migrations which would have been are returned.
+//
+// It fails without applying anything if an applied migration has changed,
+// or if the target has a migration which is not known, as the schema is
+// then newer than this version of loggui.
+func Migrate(ctx context.Context, target MigrationTarget, migrations []Migration, dryRun bool) ([]Migration, error) {
+	applied, err := target.Applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	known := map[int]bool{}
+	var pending []Migration
+
+	for _, migration := range migrations {
+		known[migration.Version] = true
+
+		checksum, ok := applied[migration.Version]
+		if !ok {
+			pending = append(pending, migration)
+			continue
+		}
+
+		if checksum != migration.Checksum {
+			return nil, fmt.Errorf("migration %d_%s has changed since it was applied", migration.Version, migration.Name)
+		}
+	}
+
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("migration %d was applied but is not known, the schema is newer than this version", version)
+		}
+	}
+
+	if dryRun {
+		return pending, nil
+	}
+
+	for i, migration := range pending {
+		if err := target.Apply(ctx, migration); err != nil {
+			return pending[:i], fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return pending, nil
+}
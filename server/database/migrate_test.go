@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// testTarget records the migrations applied to it in memory. Applying the
+// migration with version fail fails.
+type testTarget struct {
+	applied map[int]string
+	order   []int
+	fail    int
+}
+
+func (t *testTarget) Applied(context.Context) (map[int]string, error) {
+	applied := map[int]string{}
+	for version, checksum := range t.applied {
+		applied[version] = checksum
+	}
+	return applied, nil
+}
+
+func (t *testTarget) Apply(_ context.Context, migration Migration) error {
+	if migration.Version == t.fail {
+		return errors.New("syntax error")
+	}
+
+	t.applied[migration.Version] = migration.Checksum
+	t.order = append(t.order, migration.Version)
+	return nil
+}
+
+func testMigrations(t *testing.T) []Migration {
+	migrations, err := LoadMigrations(fstest.MapFS{
+		"migrations/0002_add_index.sql":    {Data: []byte("CREATE INDEX ...")},
+		"migrations/0001_create_logs.sql":  {Data: []byte("CREATE TABLE ...")},
+		"migrations/0010_add_trace_id.sql": {Data: []byte("ALTER TABLE ...")},
+		"migrations/README.md":             {Data: []byte("not a migration")},
+	}, "migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	return migrations
+}
+
+func versions(migrations []Migration) []int {
+	var out []int
+	for _, migration := range migrations {
+		out = append(out, migration.Version)
+	}
+	return out
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations := testMigrations(t)
+
+	if got := versions(migrations); !reflect.DeepEqual(got, []int{1, 2, 10}) {
+		t.Fatalf("expected the migrations in order of version, got %v", got)
+	}
+
+	first := migrations[0]
+	if first.Name != "create_logs" || first.SQL != "CREATE TABLE ..." || len(first.Checksum) != 64 {
+		t.Errorf("unexpected migration %+v", first)
+	}
+
+	if migrations[0].Checksum == migrations[1].Checksum {
+		t.Error("expected migrations with different SQL to have different checksums")
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"no version":   {"m/create_logs.sql": {}},
+		"zero version": {"m/0_create_logs.sql": {}},
+		"duplicate":    {"m/1_a.sql": {}, "m/01_b.sql": {}},
+	} {
+		if _, err := LoadMigrations(fsys, "m"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	migrations := testMigrations(t)
+	target := &testTarget{applied: map[int]string{}}
+
+	// A dry run applies nothing
+	pending, err := Migrate(context.Background(), target, migrations, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := versions(pending); !reflect.DeepEqual(got, []int{1, 2, 10}) || len(target.order) != 0 {
+		t.Fatalf("expected every migration to be pending and none applied, got %v", got)
+	}
+
+	applied, err := Migrate(context.Background(), target, migrations[:2], false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := versions(applied); !reflect.DeepEqual(got, []int{1, 2}) || !reflect.DeepEqual(target.order, []int{1, 2}) {
+		t.Fatalf("expected migrations 1 and 2 to be applied, got %v", got)
+	}
+
+	// Only the new migration is applied
+	applied, err = Migrate(context.Background(), target, migrations, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := versions(applied); !reflect.DeepEqual(got, []int{10}) || !reflect.DeepEqual(target.order, []int{1, 2, 10}) {
+		t.Fatalf("expected migration 10 to be applied, got %v", got)
+	}
+
+	if applied, err := Migrate(context.Background(), target, migrations, false); err != nil || len(applied) != 0 {
+		t.Errorf("expected nothing to apply, got %v %v", applied, err)
+	}
+}
+
+func TestMigrate_Changed(t *testing.T) {
+	migrations := testMigrations(t)
+	target := &testTarget{applied: map[int]string{1: "edited"}}
+
+	if _, err := Migrate(context.Background(), target, migrations, false); err == nil {
+		t.Error("expected a changed migration to fail")
+	}
+
+	if len(target.order) != 0 {
+		t.Errorf("expected nothing to be applied, got %v", target.order)
+	}
+}
+
+func TestMigrate_Unknown(t *testing.T) {
+	migrations := testMigrations(t)
+	target := &testTarget{applied: map[int]string{11: "newer"}}
+
+	if _, err := Migrate(context.Background(), target, migrations, false); err == nil {
+		t.Error("expected an unknown applied migration to fail")
+	}
+}
+
+func TestMigrate_Failed(t *testing.T) {
+	migrations := testMigrations(t)
+	target := &testTarget{applied: map[int]string{}, fail: 2}
+
+	applied, err := Migrate(context.Background(), target, migrations, false)
+	if err == nil {
+		t.Fatal("expected the failed migration to be reported")
+	}
+
+	// The migrations after the failed one are not applied
+	if got := versions(applied); !reflect.DeepEqual(got, []int{1}) || !reflect.DeepEqual(target.order, []int{1}) {
+		t.Errorf("expected only migration 1 to be applied, got %v", got)
+	}
+}
@@ -2,35 +2,445 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/m4tth3/loggui/core"
 	d "github.com/m4tth3/loggui/server/database"
 )
 
+// columns are the columns written, in the order of values and insertSQL
+var columns = []string{"log_id", "level", "source", "group", "message", "is_message_json", "recorded_at", "received_at", "attributes", "trace_id", "span_id"}
+
+// insertSQL skips a log whose ID is already stored, so that writing it again
+// succeeds without a copy
+const insertSQL = `
+INSERT INTO logs (log_id, level, source, "group", message, is_message_json, recorded_at, received_at, attributes, trace_id, span_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (log_id) DO NOTHING`
+
+// insertStatement is the name insertSQL is prepared under on each connection
+const insertStatement = "insert_log"
+
+const selectSQL = `
+SELECT log_id, level, source, "group", message, is_message_json, recorded_at, received_at, attributes, trace_id, span_id
+FROM logs`
+
+// driver stores the logs in PostgreSQL through a connection pool.
+//
+// Implements d.QueryHandler
 type driver struct {
-	conn *pgx.Conn
+	pool *pgxpool.Pool
 }
 
-func (d driver) Init() error {
-	// Initialize the connection or perform any setup needed.
-	return nil
+// Init applies the pending migrations.
+func (dr *driver) Init() error {
+	_, err := dr.Migrate(context.Background(), false)
+	return err
+}
+
+// GetLogs queries the logs, streaming them from the database as the
+// iterator is read.
+func (dr *driver) GetLogs(ctx context.Context, query *d.Query) (d.LogIterator, error) {
+	if query == nil {
+		query = &d.Query{}
+	}
+
+	statement, args, err := selectQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.pool.Query(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rowsIterator{rows: rows}, nil
+}
+
+// CountLogs counts the logs with a COUNT(*) of the same conditions.
+func (dr *driver) CountLogs(ctx context.Context, query *d.Query) (uint64, error) {
+	if query == nil {
+		query = &d.Query{}
+	}
+
+	w, err := queryConditions(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = dr.pool.QueryRow(ctx, "SELECT count(*) FROM logs"+w.String(), w.args...).Scan(&count)
+	return uint64(count), err
+}
+
+// WriteLog inserts the log with the prepared insert
+func (dr *driver) WriteLog(log *core.Log) error {
+	return dr.insert(context.Background(), log)
+}
+
+// WriteLogs copies the logs in with COPY FROM. A COPY fails as a whole, so
+// if it does the logs are inserted one at a time instead, to find those
+// which cannot be written and keep the rest. COPY cannot skip the logs
+// already stored either, so a batch sent again is also inserted one at a
+// time, which skips them.
+func (dr *driver) WriteLogs(ctx context.Context, logs []*core.Log) error {
+	failed := map[int]error{}
+	var rows [][]any
+	var indexes []int
+
+	for i, log := range logs {
+		row, err := values(log)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+
+		rows = append(rows, row)
+		indexes = append(indexes, i)
+	}
+
+	if len(rows) > 0 {
+		_, err := dr.pool.CopyFrom(ctx, pgx.Identifier{"logs"}, columns, pgx.CopyFromRows(rows))
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+
+			for _, i := range indexes {
+				if err := dr.insert(ctx, logs[i]); err != nil {
+					failed[i] = err
+				}
+			}
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &d.BatchError{Failed: failed}
 }
 
-func (d driver) GetLogs(filter *d.Filter) (chan *core.Log, error) {
-	return make(chan *core.Log), nil
+// insert runs insertSQL as a named prepared statement. It is prepared on a
+// connection the first time the connection inserts; Prepare returns the
+// existing statement after that without a round trip.
+func (dr *driver) insert(ctx context.Context, log *core.Log) error {
+	row, err := values(log)
+	if err != nil {
+		return err
+	}
+
+	conn, err := dr.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Conn().Prepare(ctx, insertStatement, insertSQL); err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(ctx, insertStatement, row...)
+	return err
 }
 
-func (d driver) WriteLog(log *core.Log) error {
+// Close closes every connection in the pool. It never fails, but returns
+// an error to implement io.Closer like the other drivers.
+func (dr *driver) Close() error {
+	dr.pool.Close()
 	return nil
 }
 
 func NewQueryHandler(url string) (d.QueryHandler, error) {
-	conn, err := pgx.Connect(context.Background(), url)
+	config, err := pgxpool.ParseConfig(url)
 	if err != nil {
 		return nil, err
 	}
 
-	return driver{
-		conn: conn,
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &driver{
+		pool: pool,
+	}, nil
+}
+
+func validateLog(log *core.Log) error {
+	if log == nil {
+		return errors.New("log is nil")
+	}
+
+	if log.ReceivedAt == nil {
+		return errors.New("log has no ReceivedAt")
+	}
+
+	return nil
+}
+
+// values validates the log and returns its values for the columns. The
+// attributes are encoded here rather than by pgx, so that they are stored
+// as d.EncodeJSON writes them.
+func values(log *core.Log) ([]any, error) {
+	if err := validateLog(log); err != nil {
+		return nil, err
+	}
+
+	var attributes *string
+	if len(log.Attributes) > 0 {
+		encoded, err := d.EncodeJSON(log.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attributes: %w", err)
+		}
+
+		s := string(encoded)
+		attributes = &s
+	}
+
+	return []any{
+		logID(log),
+		int16(log.Level),
+		log.Source,
+		log.Group,
+		log.Message,
+		log.IsMessageJson,
+		log.RecordedAt,
+		*log.ReceivedAt,
+		attributes,
+		log.TraceID,
+		log.SpanID,
 	}, nil
 }
+
+// rowsIterator reads the logs from the rows of a query
+//
+// Implements d.LogIterator
+type rowsIterator struct {
+	rows pgx.Rows
+	log  *core.Log
+	err  error
+}
+
+func (it *rowsIterator) Next() bool {
+	it.log = nil
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+
+	it.log, it.err = scanLog(it.rows)
+	if it.err != nil {
+		it.rows.Close()
+		return false
+	}
+
+	return true
+}
+
+func (it *rowsIterator) Log() *core.Log {
+	return it.log
+}
+
+func (it *rowsIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	return it.rows.Err()
+}
+
+func (it *rowsIterator) Close() error {
+	it.rows.Close()
+	return nil
+}
+
+func scanLog(rows pgx.Rows) (*core.Log, error) {
+	var (
+		log        core.Log
+		id         *string
+		level      int16
+		receivedAt time.Time
+	)
+
+	if err := rows.Scan(
+		&id,
+		&level,
+		&log.Source,
+		&log.Group,
+		&log.Message,
+		&log.IsMessageJson,
+		&log.RecordedAt,
+		&receivedAt,
+		&log.Attributes,
+		&log.TraceID,
+		&log.SpanID,
+	); err != nil {
+		return nil, err
+	}
+
+	if id != nil {
+		log.ID = *id
+	}
+
+	log.Level = core.Level(level)
+	log.ReceivedAt = &receivedAt
+
+	return &log, nil
+}
+
+// selectQuery translates the query into SQL and its arguments.
+func selectQuery(query *d.Query) (string, []any, error) {
+	w, err := queryConditions(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	order := "ASC"
+	if query.Order == d.Descending {
+		order = "DESC"
+	}
+
+	statement := selectSQL + w.String() + " ORDER BY received_at " + order
+	if query.Limit > 0 {
+		statement += " LIMIT " + w.arg(query.Limit)
+	}
+
+	return statement, w.args, nil
+}
+
+// queryConditions translates the filter and cursor of the query into the
+// conditions of a WHERE clause.
+func queryConditions(query *d.Query) (*where, error) {
+	filter := query.Filter
+	if filter == nil {
+		filter = &d.Filter{}
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	w := whereClause(filter)
+
+	if query.Cursor != nil {
+		op := ">"
+		if query.Order == d.Descending {
+			op = "<"
+		}
+		w.add("received_at " + op + " " + w.arg(*query.Cursor))
+	}
+
+	return w, nil
+}
+
+// whereClause translates the filter into the conditions of a WHERE clause.
+// It matches the same logs as d.Filter.Filter: source and group match a
+// substring, message is a regex, trace and span IDs match exactly, and every
+// bound is inclusive.
+func whereClause(filter *d.Filter) *where {
+	w := &where{}
+
+	if f := filter.Level; f != nil {
+		bounds(w, "level", toInt16(f.Eq), toInt16(f.Le), toInt16(f.Ge))
+	}
+
+	if f := filter.Source; f != nil && f.Eq != nil {
+		w.add("strpos(source, " + w.arg(*f.Eq) + ") > 0")
+	}
+
+	if f := filter.Group; f != nil && f.Eq != nil {
+		w.add(`strpos("group", ` + w.arg(*f.Eq) + ") > 0")
+	}
+
+	if f := filter.Message; f != nil && f.Eq != nil {
+		w.add("message ~ " + w.arg(*f.Eq))
+	}
+
+	if f := filter.ReceivedAt; f != nil {
+		bounds(w, "received_at", f.Eq, f.Le, f.Ge)
+	}
+
+	if f := filter.TraceID; f != nil && f.Eq != nil {
+		w.add("trace_id = " + w.arg(*f.Eq))
+	}
+
+	if f := filter.SpanID; f != nil && f.Eq != nil {
+		w.add("span_id = " + w.arg(*f.Eq))
+	}
+
+	// ? is served by the GIN index. The values are compared as jsonb, so
+	// that numbers match however they were written.
+	for _, attr := range filter.Attributes {
+		if attr.Value == nil {
+			w.add("attributes ? " + w.arg(attr.Key) + "::text")
+			continue
+		}
+
+		value, _ := d.EncodeJSON(attr.Value)
+		w.add("attributes -> " + w.arg(attr.Key) + "::text = " + w.arg(string(value)) + "::jsonb")
+	}
+
+	return w
+}
+
+// where builds the conditions of a WHERE clause with numbered parameters
+type where struct {
+	conditions []string
+	args       []any
+}
+
+// String returns the WHERE clause, or nothing without any conditions
+func (w *where) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+func (w *where) add(condition string) {
+	w.conditions = append(w.conditions, condition)
+}
+
+// arg adds an argument and returns its placeholder
+func (w *where) arg(value any) string {
+	w.args = append(w.args, value)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+// bounds adds the conditions for the bounds which are set
+func bounds[T any](w *where, column string, eq, le, ge *T) {
+	for _, bound := range []struct {
+		op    string
+		value *T
+	}{{"=", eq}, {"<=", le}, {">=", ge}} {
+		if bound.value != nil {
+			w.add(fmt.Sprintf("%s %s %s", column, bound.op, w.arg(*bound.value)))
+		}
+	}
+}
+
+// logID returns the ID of the log, or nil to store NULL if it has none
+func logID(log *core.Log) *string {
+	if log.ID == "" {
+		return nil
+	}
+
+	return &log.ID
+}
+
+func toInt16(level *core.Level) *int16 {
+	if level == nil {
+		return nil
+	}
+
+	n := int16(*level)
+	return &n
+}
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	d "github.com/m4tth3/loggui/server/database"
+	"github.com/m4tth3/loggui/server/database/dbtest"
+)
+
+func TestWhereClause(t *testing.T) {
+	level := core.WARN
+	source := "api"
+	message := "^user [0-9]+$"
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter *d.Filter
+		where  string
+		args   []any
+	}{
+		{"empty", &d.Filter{}, "", nil},
+		{
+			"level",
+			&d.Filter{Level: &d.FieldFilter[core.Level]{Ge: &level}},
+			" WHERE level >= $1",
+			[]any{int16(3)},
+		},
+		{
+			"every field",
+			&d.Filter{
+				Level:      d.NewLevelFilter(&level),
+				Source:     d.NewStringFilter(&source),
+				Group:      d.NewStringFilter(&source),
+				Message:    d.NewStringFilter(&message),
+				ReceivedAt: d.NewTimeFilter(nil, nil, &since),
+			},
+			` WHERE level = $1 AND strpos(source, $2) > 0 AND strpos("group", $3) > 0 AND message ~ $4 AND received_at >= $5`,
+			[]any{int16(3), source, source, message, since},
+		},
+		{
+			"attributes",
+			&d.Filter{Attributes: []d.AttributeFilter{{Key: "req"}, {Key: "status", Value: 200}}},
+			` WHERE attributes ? $1::text AND attributes -> $2::text = $3::jsonb`,
+			[]any{"req", "status", "200"},
+		},
+		{
+			"trace",
+			&d.Filter{TraceID: d.NewStringFilter(&source), SpanID: d.NewStringFilter(&message)},
+			" WHERE trace_id = $1 AND span_id = $2",
+			[]any{source, message},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := whereClause(test.filter)
+			if w.String() != test.where {
+				t.Errorf("expected %q, got %q", test.where, w.String())
+			}
+			if !reflect.DeepEqual(w.args, test.args) {
+				t.Errorf("expected args %v, got %v", test.args, w.args)
+			}
+		})
+	}
+}
+
+func TestSelectQuery(t *testing.T) {
+	level := core.WARN
+	cursor := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sql, args, err := selectQuery(&d.Query{
+		Filter: &d.Filter{Level: d.NewLevelFilter(&level)},
+		Limit:  10,
+		Order:  d.Descending,
+		Cursor: &cursor,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := selectSQL + " WHERE level = $1 AND received_at < $2 ORDER BY received_at DESC LIMIT $3"
+	if sql != expected {
+		t.Errorf("expected %q, got %q", expected, sql)
+	}
+
+	if expectedArgs := []any{int16(3), cursor, 10}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, args)
+	}
+
+	if sql, _, _ := selectQuery(&d.Query{}); sql != selectSQL+" ORDER BY received_at ASC" {
+		t.Errorf("unexpected query %q", sql)
+	}
+
+	bad := "("
+	if _, _, err := selectQuery(&d.Query{Filter: &d.Filter{Message: d.NewStringFilter(&bad)}}); err == nil {
+		t.Error("expected an invalid regex to fail")
+	}
+}
+
+// newTestDriver connects to the database in LOGGUI_POSTGRES_URL, skipping
+// the test if it is not set. The logs table is emptied first.
+func newTestDriver(t *testing.T) *driver {
+	url := os.Getenv("LOGGUI_POSTGRES_URL")
+	if url == "" {
+		t.Skip("LOGGUI_POSTGRES_URL is not set")
+	}
+
+	handler, err := NewQueryHandler(url)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	dr := handler.(*driver)
+	t.Cleanup(func() { _ = dr.Close() })
+
+	if err := dr.Init(); err != nil {
+		t.Fatalf("failed to init: %v", err)
+	}
+
+	if _, err := dr.pool.Exec(t.Context(), "TRUNCATE logs"); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+
+	return dr
+}
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) d.QueryHandler {
+		return newTestDriver(t)
+	})
+}
+
+func TestDriver(t *testing.T) {
+	dr := newTestDriver(t)
+
+	// Init can be run again on an existing schema
+	if err := dr.Init(); err != nil {
+		t.Fatalf("failed to init again: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	d "github.com/m4tth3/loggui/server/database"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock is the key of the advisory lock held while migrating
+const migrationLock = 0x6c6f67677569
+
+const migrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	checksum   TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// Migrate applies the pending migrations while holding an advisory lock, so
+// that instances sharing the database take turns. A dry run only reads, so
+// it takes no lock.
+//
+// Implements d.Migrator
+func (dr *driver) Migrate(ctx context.Context, dryRun bool) ([]d.Migration, error) {
+	all, err := d.LoadMigrations(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dr.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if dryRun {
+		return d.Migrate(ctx, &migrationTarget{conn: conn, dryRun: true}, all, true)
+	}
+
+	// The lock is held by the session, so everything is run on this
+	// connection and it is unlocked before being returned to the pool
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return nil, err
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	return d.Migrate(ctx, &migrationTarget{conn: conn}, all, false)
+}
+
+// migrationTarget applies migrations over a single connection. For a dry
+// run it only reads, and schema_migrations is not created.
+//
+// Implements d.MigrationTarget
+type migrationTarget struct {
+	conn   *pgxpool.Conn
+	dryRun bool
+}
+
+func (t *migrationTarget) Applied(ctx context.Context) (map[int]string, error) {
+	if t.dryRun {
+		var exists bool
+		err := t.conn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+		if err != nil || !exists {
+			return map[int]string{}, err
+		}
+	} else if _, err := t.conn.Exec(ctx, migrationsTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := t.conn.Query(ctx, "SELECT version, checksum FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]string{}
+	var version int
+	var checksum string
+
+	_, err = pgx.ForEachRow(rows, []any{&version, &checksum}, func() error {
+		applied[version] = checksum
+		return nil
+	})
+
+	return applied, err
+}
+
+// Apply runs the migration in a transaction, which DDL is part of in
+// PostgreSQL.
+func (t *migrationTarget) Apply(ctx context.Context, migration d.Migration) error {
+	tx, err := t.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	if _, err := tx.Exec(ctx, migration.SQL); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+		migration.Version, migration.Name, migration.Checksum,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
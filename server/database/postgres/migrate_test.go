@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"testing"
+
+	d "github.com/m4tth3/loggui/server/database"
+)
+
+func TestMigrations(t *testing.T) {
+	all, err := d.LoadMigrations(migrations, "migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if len(all) == 0 || all[0].Version != 1 {
+		t.Fatalf("expected the migrations to start at version 1, got %v", all)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dr := newTestDriver(t)
+
+	// newTestDriver has already applied every migration
+	pending, err := dr.Migrate(t.Context(), true)
+	if err != nil {
+		t.Fatalf("failed to dry run: %v", err)
+	}
+
+	if len(pending) != 0 {
+		t.Errorf("expected nothing pending, got %v", pending)
+	}
+
+	var applied int
+	if err := dr.pool.QueryRow(t.Context(), "SELECT count(*) FROM schema_migrations").Scan(&applied); err != nil || applied == 0 {
+		t.Errorf("expected the applied migrations to be recorded, got %d %v", applied, err)
+	}
+}
@@ -0,0 +1,17 @@
+-- received_at is a timestamptz, which keeps the microsecond precision the
+-- LogManager stamps logs with, so it can be used as a cursor.
+CREATE TABLE IF NOT EXISTS logs (
+	id              BIGSERIAL PRIMARY KEY,
+	level           SMALLINT NOT NULL,
+	source          TEXT,
+	"group"         TEXT,
+	message         TEXT NOT NULL,
+	is_message_json BOOLEAN NOT NULL DEFAULT FALSE,
+	recorded_at     TIMESTAMPTZ NOT NULL,
+	received_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS logs_received_at_idx ON logs (received_at);
+CREATE INDEX IF NOT EXISTS logs_level_idx ON logs (level);
+CREATE INDEX IF NOT EXISTS logs_source_idx ON logs (source);
+CREATE INDEX IF NOT EXISTS logs_group_idx ON logs ("group");
@@ -0,0 +1,5 @@
+-- attributes is the JSON object of the log's attributes, or NULL if it has
+-- none. The GIN index serves filters on which attributes a log has.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS attributes JSONB;
+
+CREATE INDEX IF NOT EXISTS logs_attributes_idx ON logs USING GIN (attributes);
@@ -0,0 +1,6 @@
+-- trace_id and span_id tie a log to a distributed trace. Most queries ask
+-- for every log of a trace, so only trace_id leads an index.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS trace_id TEXT;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS span_id TEXT;
+
+CREATE INDEX IF NOT EXISTS logs_trace_id_idx ON logs (trace_id, span_id);
@@ -0,0 +1,7 @@
+-- log_id is the ID the client gave the log, so that a log sent again is
+-- only stored once. id is kept as the primary key. Logs written before
+-- log_id was added have none, and as NULLs are distinct they do not
+-- conflict.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS log_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS logs_log_id_idx ON logs (log_id);
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+// Order is the order of ReceivedAt logs are read in.
+type Order int
+
+const (
+	// Ascending reads the oldest logs first
+	Ascending Order = iota
+	// Descending reads the newest logs first
+	Descending
+)
+
+// Query selects the logs read by QueryHandler.GetLogs.
+type Query struct {
+	Filter *Filter
+
+	// Limit is the most logs read. Zero reads every matching log.
+	Limit int
+
+	Order Order
+
+	// Cursor is the ReceivedAt of the log to start after, in the order of
+	// the query. The log received at the cursor is not read.
+	Cursor *time.Time
+}
+
+// After checks the time is past the cursor, in the order of the query.
+// Every time is past a nil cursor.
+func (q *Query) After(t time.Time) bool {
+	switch {
+	case q.Cursor == nil:
+		return true
+	case q.Order == Descending:
+		return t.Before(*q.Cursor)
+	default:
+		return t.After(*q.Cursor)
+	}
+}
+
+// LogIterator reads the logs of a query one at a time:
+//
+//	it, err := db.GetLogs(ctx, query)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//
+//	for it.Next() {
+//		log := it.Log()
+//	}
+//
+//	return it.Err()
+//
+// Close must be called once done, even if not every log was read, to free
+// the resources held by the query.
+type LogIterator interface {
+	// Next moves to the next log. It returns false once there are no more,
+	// or reading one failed.
+	Next() bool
+
+	// Log returns the log Next moved to.
+	Log() *core.Log
+
+	// Err returns the error which stopped Next, if any.
+	Err() error
+
+	Close() error
+}
+
+// sliceIterator iterates over logs already in memory
+//
+// Implements LogIterator
+type sliceIterator struct {
+	logs []*core.Log
+	log  *core.Log
+}
+
+// NewSliceIterator returns an iterator over the logs, in the order given.
+func NewSliceIterator(logs []*core.Log) LogIterator {
+	return &sliceIterator{logs: logs}
+}
+
+func (it *sliceIterator) Next() bool {
+	if len(it.logs) == 0 {
+		it.log = nil
+		return false
+	}
+
+	it.log, it.logs = it.logs[0], it.logs[1:]
+	return true
+}
+
+func (it *sliceIterator) Log() *core.Log {
+	return it.log
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	it.logs = nil
+	return nil
+}
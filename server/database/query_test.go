@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+func TestQuery_After(t *testing.T) {
+	cursor := time.Now()
+	before := cursor.Add(-time.Microsecond)
+	after := cursor.Add(time.Microsecond)
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected [3]bool // before, at and after the cursor
+	}{
+		{"no cursor", Query{}, [3]bool{true, true, true}},
+		{"ascending", Query{Cursor: &cursor}, [3]bool{false, false, true}},
+		{"descending", Query{Cursor: &cursor, Order: Descending}, [3]bool{true, false, false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := [3]bool{test.query.After(before), test.query.After(cursor), test.query.After(after)}
+			if got != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestSliceIterator(t *testing.T) {
+	it := NewSliceIterator([]*core.Log{{Message: "1"}, {Message: "2"}})
+
+	var messages []string
+	for it.Next() {
+		messages = append(messages, it.Log().Message)
+	}
+
+	if len(messages) != 2 || messages[0] != "1" || messages[1] != "2" {
+		t.Errorf("expected the logs in order, got %v", messages)
+	}
+
+	if it.Log() != nil || it.Err() != nil || it.Close() != nil {
+		t.Error("expected an exhausted iterator to have no log or error")
+	}
+}
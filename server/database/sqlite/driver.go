@@ -1,5 +1,543 @@
 package sqlite
 
-type DbDriver struct {
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/m4tth3/loggui/core"
+	d "github.com/m4tth3/loggui/server/database"
+	"modernc.org/sqlite"
+)
+
+const (
+	// driverName is the database/sql driver registered by modernc.org/sqlite
+	driverName = "sqlite"
+
+	// busyTimeout is how long a write waits for another to finish
+	busyTimeout = 5 * time.Second
+)
+
+// columns are the columns written, in the order of values
+var columns = []string{"log_id", "level", "source", `"group"`, "message", "is_message_json", "recorded_at", "received_at", "attributes", "trace_id", "span_id"}
+
+// maxBatchRows keeps a multi-row insert within the 999 variables older
+// versions of SQLite allow in a statement
+var maxBatchRows = 999 / len(columns)
+
+// insertSQL returns an insert of the given number of rows. A log whose ID
+// is already stored is skipped, so that writing it again succeeds without
+// a copy.
+func insertSQL(rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	placeholders := strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+
+	return "INSERT INTO logs (" + strings.Join(columns, ", ") + ") VALUES " + placeholders + " ON CONFLICT (log_id) DO NOTHING"
+}
+
+const selectSQL = `
+SELECT log_id, level, source, "group", message, is_message_json, recorded_at, received_at, attributes, trace_id, span_id
+FROM logs`
+
+var (
+	registerOnce sync.Once
+	registerErr  error
+)
+
+// register registers a regexp function, which the driver adds to every
+// connection, so that the REGEXP operator can be used
+func register() error {
+	registerOnce.Do(func() {
+		var patterns sync.Map
+
+		registerErr = sqlite.RegisterDeterministicScalarFunction("regexp", 2, func(_ *sqlite.FunctionContext, args []sqldriver.Value) (sqldriver.Value, error) {
+			pattern, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("regexp: pattern must be text, got %T", args[0])
+			}
+
+			var s string
+			switch v := args[1].(type) {
+			case nil:
+				return nil, nil
+			case string:
+				s = v
+			case []byte:
+				s = string(v)
+			default:
+				s = fmt.Sprint(v)
+			}
+
+			re, ok := patterns.Load(pattern)
+			if !ok {
+				compiled, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, err
+				}
+				re, _ = patterns.LoadOrStore(pattern, compiled)
+			}
+
+			return re.(*regexp.Regexp).MatchString(s), nil
+		})
+	})
+
+	return registerErr
+}
+
+// driver stores the logs in a SQLite database file.
+//
+// Implements d.QueryHandler
+type driver struct {
+	db *sql.DB
+}
+
+// Init switches the database to WAL mode, so that reads are not blocked by
+// writes, and applies the pending migrations.
+func (dr *driver) Init() error {
+	if _, err := dr.db.Exec("PRAGMA journal_mode = WAL"); err != nil {
+		return err
+	}
+
+	_, err := dr.Migrate(context.Background(), false)
+	return err
+}
+
+// GetLogs queries the logs, streaming them from the database as the
+// iterator is read.
+func (dr *driver) GetLogs(ctx context.Context, query *d.Query) (d.LogIterator, error) {
+	if query == nil {
+		query = &d.Query{}
+	}
+
+	statement, args, err := selectQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rowsIterator{rows: rows}, nil
+}
+
+// CountLogs counts the logs with a COUNT(*) of the same conditions.
+func (dr *driver) CountLogs(ctx context.Context, query *d.Query) (uint64, error) {
+	if query == nil {
+		query = &d.Query{}
+	}
+
+	where, args, err := queryConditions(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint64
+	err = dr.db.QueryRowContext(ctx, "SELECT count(*) FROM logs"+where, args...).Scan(&count)
+	return count, err
+}
+
+// WriteLog inserts the log.
+func (dr *driver) WriteLog(log *core.Log) error {
+	err := dr.WriteLogs(context.Background(), []*core.Log{log})
+
+	var batchErr *d.BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Failed[0]
+	}
+
+	return err
+}
+
+// WriteLogs inserts the logs in a single transaction, so that a batch costs
+// one sync to disk rather than one for each log. They are inserted
+// maxBatchRows at a time, and if a multi-row insert fails its logs are
+// inserted one at a time instead, to find those which cannot be written
+// and keep the rest.
+func (dr *driver) WriteLogs(ctx context.Context, logs []*core.Log) error {
+	failed := map[int]error{}
+	var rows [][]any
+	var indexes []int
+
+	for i, log := range logs {
+		row, err := values(log)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+
+		rows = append(rows, row)
+		indexes = append(indexes, i)
+	}
+
+	if len(rows) > 0 {
+		if err := dr.insert(ctx, rows, indexes, failed); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &d.BatchError{Failed: failed}
+}
+
+// insert writes the rows in a transaction, adding the indexes of the logs
+// which fail to failed. An error is only returned if none were written.
+func (dr *driver) insert(ctx context.Context, rows [][]any, indexes []int, failed map[int]error) error {
+	tx, err := dr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(rows); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(rows))
+
+		var args []any
+		for _, row := range rows[start:end] {
+			args = append(args, row...)
+		}
+
+		if _, err := tx.ExecContext(ctx, insertSQL(end-start), args...); err == nil {
+			continue
+		} else if ctx.Err() != nil {
+			return err
+		}
+
+		// A failed statement is undone on its own, leaving the
+		// transaction open to insert the logs one at a time
+		for j := start; j < end; j++ {
+			if _, err := tx.ExecContext(ctx, insertSQL(1), rows[j]...); err != nil {
+				failed[indexes[j]] = err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Close closes the database.
+func (dr *driver) Close() error {
+	return dr.db.Close()
+}
+
+// NewQueryHandler opens the SQLite database at path, creating it if it
+// does not exist.
+func NewQueryHandler(path string) (d.QueryHandler, error) {
+	return open(path, url.Values{"_txlock": {"immediate"}})
+}
+
+// NewReadOnlyQueryHandler opens the existing SQLite database at path
+// read-only, so that it can be inspected without being changed. Writes to
+// it fail.
+func NewReadOnlyQueryHandler(path string) (d.QueryHandler, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	return open(path, url.Values{"mode": {"ro"}})
+}
+
+func open(path string, params url.Values) (d.QueryHandler, error) {
+	if err := register(); err != nil {
+		return nil, err
+	}
+
+	params.Set("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+
+	db, err := sql.Open(driverName, "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &driver{
+		db: db,
+	}, nil
+}
+
+func validateLog(log *core.Log) error {
+	if log == nil {
+		return errors.New("log is nil")
+	}
+
+	if log.ReceivedAt == nil {
+		return errors.New("log has no ReceivedAt")
+	}
+
+	return nil
+}
+
+// values validates the log and returns its values for the columns
+func values(log *core.Log) ([]any, error) {
+	if err := validateLog(log); err != nil {
+		return nil, err
+	}
+
+	var attributes *string
+	if len(log.Attributes) > 0 {
+		encoded, err := d.EncodeJSON(log.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attributes: %w", err)
+		}
+
+		s := string(encoded)
+		attributes = &s
+	}
+
+	return []any{
+		logID(log),
+		int(log.Level),
+		log.Source,
+		log.Group,
+		log.Message,
+		log.IsMessageJson,
+		log.RecordedAt.UnixMicro(),
+		log.ReceivedAt.UnixMicro(),
+		attributes,
+		log.TraceID,
+		log.SpanID,
+	}, nil
+}
+
+// rowsIterator reads the logs from the rows of a query
+//
+// Implements d.LogIterator
+type rowsIterator struct {
+	rows *sql.Rows
+	log  *core.Log
+	err  error
+}
+
+func (it *rowsIterator) Next() bool {
+	it.log = nil
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+
+	it.log, it.err = scanLog(it.rows)
+	return it.err == nil
+}
+
+func (it *rowsIterator) Log() *core.Log {
+	return it.log
+}
+
+func (it *rowsIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	return it.rows.Err()
+}
+
+func (it *rowsIterator) Close() error {
+	return it.rows.Close()
+}
+
+func scanLog(rows *sql.Rows) (*core.Log, error) {
+	var (
+		log        core.Log
+		recordedAt int64
+		receivedAt int64
+		id         sql.NullString
+		attributes sql.NullString
+	)
+
+	if err := rows.Scan(
+		&id,
+		&log.Level,
+		&log.Source,
+		&log.Group,
+		&log.Message,
+		&log.IsMessageJson,
+		&recordedAt,
+		&receivedAt,
+		&attributes,
+		&log.TraceID,
+		&log.SpanID,
+	); err != nil {
+		return nil, err
+	}
+
+	if attributes.Valid {
+		if err := json.Unmarshal([]byte(attributes.String), &log.Attributes); err != nil {
+			return nil, fmt.Errorf("failed to decode attributes: %w", err)
+		}
+	}
+
+	log.ID = id.String
+	received := time.UnixMicro(receivedAt)
+	log.RecordedAt = time.UnixMicro(recordedAt)
+	log.ReceivedAt = &received
+
+	return &log, nil
+}
+
+// selectQuery translates the query into SQL and its arguments.
+func selectQuery(query *d.Query) (string, []any, error) {
+	where, args, err := queryConditions(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	order := "ASC"
+	if query.Order == d.Descending {
+		order = "DESC"
+	}
+
+	statement := selectSQL + where + " ORDER BY received_at " + order
+	if query.Limit > 0 {
+		statement += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	return statement, args, nil
+}
+
+// queryConditions translates the filter and cursor of the query into a
+// WHERE clause and its arguments.
+func queryConditions(query *d.Query) (string, []any, error) {
+	filter := query.Filter
+	if filter == nil {
+		filter = &d.Filter{}
+	}
+
+	if err := filter.Validate(); err != nil {
+		return "", nil, err
+	}
+
+	where, args := whereClause(filter)
+
+	if query.Cursor != nil {
+		op := ">"
+		if query.Order == d.Descending {
+			op = "<"
+		}
+
+		condition := "received_at " + op + " ?"
+		if where == "" {
+			where = " WHERE " + condition
+		} else {
+			where += " AND " + condition
+		}
+		args = append(args, query.Cursor.UnixMicro())
+	}
+
+	return where, args, nil
+}
+
+// whereClause translates the filter into a WHERE clause and its arguments.
+// It matches the same logs as d.Filter.Filter: source and group match a
+// substring, message is a regex, trace and span IDs match exactly, and every
+// bound is inclusive.
+func whereClause(filter *d.Filter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, arg ...any) {
+		conditions = append(conditions, condition)
+		args = append(args, arg...)
+	}
+
+	bounds := func(column string, eq, le, ge *int64) {
+		for _, bound := range []struct {
+			op    string
+			value *int64
+		}{{"=", eq}, {"<=", le}, {">=", ge}} {
+			if bound.value != nil {
+				add(column+" "+bound.op+" ?", *bound.value)
+			}
+		}
+	}
+
+	if f := filter.Level; f != nil {
+		bounds("level", levelValue(f.Eq), levelValue(f.Le), levelValue(f.Ge))
+	}
+
+	if f := filter.Source; f != nil && f.Eq != nil {
+		add("instr(source, ?) > 0", *f.Eq)
+	}
+
+	if f := filter.Group; f != nil && f.Eq != nil {
+		add(`instr("group", ?) > 0`, *f.Eq)
+	}
+
+	if f := filter.Message; f != nil && f.Eq != nil {
+		add("message REGEXP ?", *f.Eq)
+	}
+
+	if f := filter.ReceivedAt; f != nil {
+		bounds("received_at", timeValue(f.Eq), timeValue(f.Le), timeValue(f.Ge))
+	}
+
+	if f := filter.TraceID; f != nil && f.Eq != nil {
+		add("trace_id = ?", *f.Eq)
+	}
+
+	if f := filter.SpanID; f != nil && f.Eq != nil {
+		add("span_id = ?", *f.Eq)
+	}
+
+	// -> returns the attribute as JSON text, or NULL if the log does not
+	// have it. Validate has checked the key can be quoted into the path.
+	for _, attr := range filter.Attributes {
+		path := `$."` + attr.Key + `"`
+		if attr.Value == nil {
+			add("attributes -> ? IS NOT NULL", path)
+			continue
+		}
+
+		value, _ := d.EncodeJSON(attr.Value)
+		add("attributes -> ? = ?", path, string(value))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// logID returns the ID of the log, or nil to store NULL if it has none
+func logID(log *core.Log) *string {
+	if log.ID == "" {
+		return nil
+	}
+
+	return &log.ID
+}
+
+func levelValue(level *core.Level) *int64 {
+	if level == nil {
+		return nil
+	}
+
+	n := int64(*level)
+	return &n
+}
+
+func timeValue(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+
+	n := t.UnixMicro()
+	return &n
 }
@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	d "github.com/m4tth3/loggui/server/database"
+	"github.com/m4tth3/loggui/server/database/dbtest"
+)
+
+func newTestDriver(t *testing.T) *driver {
+	handler, err := NewQueryHandler(filepath.Join(t.TempDir(), "loggui.db"))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	dr := handler.(*driver)
+	t.Cleanup(func() { _ = dr.Close() })
+
+	if err := dr.Init(); err != nil {
+		t.Fatalf("failed to init: %v", err)
+	}
+
+	return dr
+}
+
+func TestWhereClause(t *testing.T) {
+	level := core.WARN
+	source := "api"
+	message := "^user [0-9]+$"
+	since := time.UnixMicro(1000)
+
+	where, args := whereClause(&d.Filter{
+		Level:      &d.FieldFilter[core.Level]{Ge: &level},
+		Source:     d.NewStringFilter(&source),
+		Group:      d.NewStringFilter(&source),
+		Message:    d.NewStringFilter(&message),
+		ReceivedAt: d.NewTimeFilter(nil, nil, &since),
+	})
+
+	expected := ` WHERE level >= ? AND instr(source, ?) > 0 AND instr("group", ?) > 0 AND message REGEXP ? AND received_at >= ?`
+	if where != expected {
+		t.Errorf("expected %q, got %q", expected, where)
+	}
+
+	if expectedArgs := []any{int64(3), source, source, message, int64(1000)}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, args)
+	}
+
+	if where, args := whereClause(&d.Filter{}); where != "" || args != nil {
+		t.Errorf("expected an empty clause, got %q %v", where, args)
+	}
+}
+
+func TestDriver_WAL(t *testing.T) {
+	dr := newTestDriver(t)
+
+	var mode string
+	if err := dr.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("failed to read journal mode: %v", err)
+	}
+
+	if mode != "wal" {
+		t.Errorf("expected wal journal mode, got %s", mode)
+	}
+
+	// Init can be run again on an existing schema
+	if err := dr.Init(); err != nil {
+		t.Fatalf("failed to init again: %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) d.QueryHandler {
+		return newTestDriver(t)
+	})
+}
+
+func TestDriver_GetLogsClose(t *testing.T) {
+	dr := newTestDriver(t)
+
+	base := time.Now()
+	var logs []*core.Log
+	for i := range 10 {
+		receivedAt := base.Add(time.Duration(i) * time.Microsecond)
+		logs = append(logs, &core.Log{Level: core.INFO, Message: fmt.Sprint(i), ReceivedAt: &receivedAt})
+	}
+
+	if err := dr.WriteLogs(t.Context(), logs); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	// Closing before reading every log frees the connection for the next
+	dr.db.SetMaxOpenConns(1)
+	for range 3 {
+		it, err := dr.GetLogs(t.Context(), nil)
+		if err != nil {
+			t.Fatalf("failed to get logs: %v", err)
+		}
+
+		if !it.Next() || it.Log().Message != "0" {
+			t.Fatalf("expected the first log, got %v", it.Err())
+		}
+
+		if err := it.Close(); err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := dr.GetLogs(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled query to fail, got %v", err)
+	}
+}
+
+func TestDriver_WriteLogs(t *testing.T) {
+	dr := newTestDriver(t)
+
+	// Reject a single log, so that the multi-row insert it is in fails
+	if _, err := dr.db.Exec(`CREATE TRIGGER reject BEFORE INSERT ON logs WHEN NEW.message = 'bad'
+		BEGIN SELECT RAISE(ABORT, 'rejected'); END`); err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	base := time.Now()
+	var logs []*core.Log
+	for i := range maxBatchRows + 10 {
+		receivedAt := base.Add(time.Duration(i) * time.Microsecond)
+		logs = append(logs, &core.Log{Level: core.INFO, Message: fmt.Sprint(i), ReceivedAt: &receivedAt})
+	}
+
+	logs[3].Message = "bad"
+	logs[maxBatchRows+1].ReceivedAt = nil
+
+	err := dr.WriteLogs(t.Context(), logs)
+
+	var batchErr *d.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+
+	if len(batchErr.Failed) != 2 || batchErr.Failed[3] == nil || batchErr.Failed[maxBatchRows+1] == nil {
+		t.Errorf("expected logs 3 and %d to fail, got %v", maxBatchRows+1, batchErr.Failed)
+	}
+
+	// Every other log is kept
+	written := dbtest.ReadAll(t, dr, nil)
+	for _, log := range written {
+		if log.Message == "bad" {
+			t.Error("expected the rejected log not to be written")
+		}
+	}
+
+	if len(written) != len(logs)-2 {
+		t.Errorf("expected %d logs, got %d", len(logs)-2, len(written))
+	}
+
+	if err := dr.WriteLog(logs[3]); err == nil || errors.As(err, &batchErr) {
+		t.Errorf("expected the log's own error, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+
+	d "github.com/m4tth3/loggui/server/database"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const migrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	checksum   TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+)`
+
+// Migrate applies the pending migrations in a single transaction. It is
+// begun immediately, taking the write lock on the database file, so that
+// processes sharing the file take turns. A dry run only reads, outside of
+// a transaction, so it works on a database opened read-only.
+//
+// Implements d.Migrator
+func (dr *driver) Migrate(ctx context.Context, dryRun bool) ([]d.Migration, error) {
+	all, err := d.LoadMigrations(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return d.Migrate(ctx, &migrationTarget{conn: dr.db, dryRun: true}, all, true)
+	}
+
+	// The database is opened with _txlock=immediate
+	tx, err := dr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The migrations applied before one which failed are kept
+	applied, err := d.Migrate(ctx, &migrationTarget{conn: tx}, all, false)
+	if commitErr := tx.Commit(); commitErr != nil {
+		return nil, commitErr
+	}
+
+	return applied, err
+}
+
+// conn is the part of *sql.DB and *sql.Tx used by migrationTarget
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// migrationTarget applies migrations within the transaction holding the
+// lock. Each is run in a savepoint, so a failed one is undone on its own.
+// For a dry run it only reads, and schema_migrations is not created.
+//
+// Implements d.MigrationTarget
+type migrationTarget struct {
+	conn   conn
+	dryRun bool
+}
+
+func (t *migrationTarget) Applied(ctx context.Context) (map[int]string, error) {
+	if t.dryRun {
+		var tables int
+		err := t.conn.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&tables)
+		if err != nil || tables == 0 {
+			return map[int]string{}, err
+		}
+	} else if _, err := t.conn.ExecContext(ctx, migrationsTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := t.conn.QueryContext(ctx, "SELECT version, checksum FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var checksum string
+
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = checksum
+	}
+
+	return applied, rows.Err()
+}
+
+func (t *migrationTarget) Apply(ctx context.Context, migration d.Migration) error {
+	if _, err := t.conn.ExecContext(ctx, "SAVEPOINT migration"); err != nil {
+		return err
+	}
+
+	_, err := t.conn.ExecContext(ctx, migration.SQL)
+	if err == nil {
+		_, err = t.conn.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, strftime('%s', 'now'))",
+			migration.Version, migration.Name, migration.Checksum,
+		)
+	}
+
+	if err != nil {
+		_, _ = t.conn.ExecContext(ctx, "ROLLBACK TO migration")
+		return err
+	}
+
+	_, err = t.conn.ExecContext(ctx, "RELEASE migration")
+	return err
+}
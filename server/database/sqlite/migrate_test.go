@@ -0,0 +1,125 @@
+package sqlite
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+)
+
+func TestMigrate(t *testing.T) {
+	handler, err := NewQueryHandler(filepath.Join(t.TempDir(), "loggui.db"))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	dr := handler.(*driver)
+	t.Cleanup(func() { _ = dr.Close() })
+
+	pending, err := dr.Migrate(t.Context(), true)
+	if err != nil {
+		t.Fatalf("failed to dry run: %v", err)
+	}
+
+	if len(pending) == 0 || pending[0].Version != 1 {
+		t.Fatalf("expected the migrations to be pending, got %v", pending)
+	}
+
+	// A dry run leaves the schema as it was, without even recording the
+	// migrations
+	var tables int
+	if err := dr.db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name IN ('logs', 'schema_migrations')").Scan(&tables); err != nil || tables != 0 {
+		t.Fatalf("expected no tables after a dry run, got %d %v", tables, err)
+	}
+
+	if err := dr.Init(); err != nil {
+		t.Fatalf("failed to init: %v", err)
+	}
+
+	var applied int
+	if err := dr.db.QueryRow("SELECT count(*) FROM schema_migrations").Scan(&applied); err != nil || applied != len(pending) {
+		t.Errorf("expected %d applied migrations, got %d %v", len(pending), applied, err)
+	}
+
+	if pending, err := dr.Migrate(t.Context(), true); err != nil || len(pending) != 0 {
+		t.Errorf("expected nothing pending after init, got %v %v", pending, err)
+	}
+}
+
+func TestMigrate_ReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loggui.db")
+
+	// A database which does not exist is not created
+	if _, err := NewReadOnlyQueryHandler(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a missing database to fail, got %v", err)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the database not to be created, got %v", err)
+	}
+
+	handler, err := NewQueryHandler(path)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	if err := handler.Init(); err != nil {
+		t.Fatalf("failed to init: %v", err)
+	}
+	_ = handler.(*driver).Close()
+
+	handler, err = NewReadOnlyQueryHandler(path)
+	if err != nil {
+		t.Fatalf("failed to open read-only: %v", err)
+	}
+
+	dr := handler.(*driver)
+	t.Cleanup(func() { _ = dr.Close() })
+
+	if pending, err := dr.Migrate(t.Context(), true); err != nil || len(pending) != 0 {
+		t.Errorf("expected nothing pending, got %v %v", pending, err)
+	}
+
+	now := time.Now()
+	if err := dr.WriteLog(&core.Log{Message: "hello", RecordedAt: now, ReceivedAt: &now}); err == nil {
+		t.Errorf("expected writing to a read-only database to fail")
+	}
+}
+
+func TestMigrate_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loggui.db")
+
+	// Instances sharing a file take turns, and only the first applies
+	// anything
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+
+	for i := range errs {
+		handler, err := NewQueryHandler(path)
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+
+		dr := handler.(*driver)
+		t.Cleanup(func() { _ = dr.Close() })
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = dr.Init()
+		}()
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("instance %d failed to init: %v", i, err)
+		}
+	}
+}
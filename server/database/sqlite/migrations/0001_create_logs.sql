@@ -0,0 +1,18 @@
+-- Both times are stored as microseconds since the epoch. This keeps the
+-- precision the LogManager stamps logs with, so received_at can be used as a
+-- cursor, and sorts and compares as a plain integer.
+CREATE TABLE IF NOT EXISTS logs (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	level           INTEGER NOT NULL,
+	source          TEXT,
+	"group"         TEXT,
+	message         TEXT NOT NULL,
+	is_message_json INTEGER NOT NULL DEFAULT 0,
+	recorded_at     INTEGER NOT NULL,
+	received_at     INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS logs_received_at_idx ON logs (received_at);
+CREATE INDEX IF NOT EXISTS logs_level_idx ON logs (level);
+CREATE INDEX IF NOT EXISTS logs_source_idx ON logs (source);
+CREATE INDEX IF NOT EXISTS logs_group_idx ON logs ("group");
@@ -0,0 +1,3 @@
+-- attributes is the JSON object of the log's attributes, or NULL if it has
+-- none. They are filtered with the -> operator, which needs SQLite 3.38.
+ALTER TABLE logs ADD COLUMN attributes TEXT;
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/storage"
+)
+
+const (
+	// maxIngestBodySize is the largest request body accepted by the ingest
+	// endpoint.
+	maxIngestBodySize = 10 << 20
+
+	// maxLogIDLength is the longest log ID accepted. A UUID is 36
+	// characters and a ULID 26.
+	maxLogIDLength = 64
+)
+
+// A duplicate log was received before, e.g. by a client retrying, so it is
+// counted as accepted without being stored again.
+const (
+	ingestAccepted  = "accepted"
+	ingestDuplicate = "duplicate"
+	ingestRejected  = "rejected"
+)
+
+// ingestResult reports what happened to a single log of an ingest request.
+// Index is the position of the log in the submitted batch.
+type ingestResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ingestResponse struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Results  []ingestResult `json:"results"`
+}
+
+// ingestHandler receives logs from clients and passes them onto the
+// LogManager. The body is either a single core.Log or a JSON array of them
+// (application/json), or one core.Log per line (application/x-ndjson). It
+// may be gzip compressed.
+//
+// POST /api/v1/logs
+type ingestHandler struct {
+	manager *storage.LogManager
+}
+
+func newIngestHandler(manager *storage.LogManager) *ingestHandler {
+	return &ingestHandler{manager: manager}
+}
+
+func (h *ingestHandler) serveHTTP(c *context) {
+	switch encoding := c.Request.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		body, err := gzip.NewReader(c.Body)
+		if err != nil {
+			c.writeError(http.StatusBadRequest, "malformed_payload", err.Error())
+			return
+		}
+		defer body.Close()
+
+		c.Body = body
+	default:
+		c.writeError(http.StatusUnsupportedMediaType, "unsupported_encoding",
+			fmt.Sprintf("unsupported content encoding %q", encoding))
+		return
+	}
+
+	switch mediaType(c.Request) {
+	case "", "application/json":
+		h.serveJSON(c)
+	case "application/x-ndjson":
+		h.serveNDJSON(c)
+	default:
+		c.writeError(http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"content type must be application/json or application/x-ndjson")
+	}
+}
+
+// serveJSON handles a single log or a JSON array of logs. The whole body is
+// read before any log is stored.
+func (h *ingestHandler) serveJSON(c *context) {
+	raw, err := io.ReadAll(http.MaxBytesReader(c.ResponseWriter, c.Body, maxIngestBodySize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.writeError(http.StatusRequestEntityTooLarge, "payload_too_large",
+				fmt.Sprintf("payload exceeds %d bytes", maxErr.Limit))
+			return
+		}
+
+		c.writeError(http.StatusBadRequest, "read_failed", err.Error())
+		return
+	}
+
+	items, err := decodeBatch(raw)
+	if err != nil {
+		c.writeError(http.StatusBadRequest, "malformed_payload", err.Error())
+		return
+	}
+
+	resp := ingestResponse{Results: make([]ingestResult, 0, len(items))}
+	receivedAt := time.Now()
+
+	for i, item := range items {
+		result := ingestResult{Index: i, Status: ingestAccepted}
+
+		err := h.ingest(item, receivedAt)
+		if errors.Is(err, storage.ErrDuplicate) {
+			result.Status = ingestDuplicate
+			resp.Accepted++
+		} else if err != nil {
+			result.Status = ingestRejected
+			result.Error = err.Error()
+			resp.Rejected++
+		} else {
+			resp.Accepted++
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	c.writeJSON(http.StatusOK, resp)
+}
+
+// ingest decodes, validates and stores a single log.
+func (h *ingestHandler) ingest(item json.RawMessage, receivedAt time.Time) error {
+	log, err := decodeLog(item)
+	if err != nil {
+		return err
+	}
+
+	return h.store(log, receivedAt)
+}
+
+// store validates the log and passes it to the LogManager. It blocks while
+// the LogManager is busy, which is what applies backpressure to clients.
+// A log from a client which does not set an ID is given one, so that every
+// stored log has one.
+func (h *ingestHandler) store(log *core.Log, receivedAt time.Time) error {
+	if err := validateLog(log); err != nil {
+		return err
+	}
+
+	if log.ID == "" {
+		log.ID = core.NewID()
+	}
+
+	log.ReceivedAt = &receivedAt
+
+	return h.manager.Write(log)
+}
+
+func decodeLog(item []byte) (*core.Log, error) {
+	log := &core.Log{}
+	if err := json.Unmarshal(item, log); err != nil {
+		return nil, fmt.Errorf("invalid log: %w", err)
+	}
+
+	return log, nil
+}
+
+// decodeBatch splits the payload into its individual logs without decoding
+// them, so that a bad log only rejects itself and not the whole batch.
+func decodeBatch(raw []byte) ([]json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, errors.New("empty payload")
+	}
+
+	switch raw[0] {
+	case '{':
+		if !json.Valid(raw) {
+			return nil, errors.New("payload is not valid JSON")
+		}
+
+		return []json.RawMessage{raw}, nil
+	case '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("payload is not valid JSON: %w", err)
+		}
+
+		if len(items) == 0 {
+			return nil, errors.New("empty payload")
+		}
+
+		return items, nil
+	default:
+		return nil, errors.New("payload must be a log object or an array of logs")
+	}
+}
+
+// validateLog checks the fields a client is responsible for setting.
+func validateLog(log *core.Log) error {
+	if !log.Level.Valid() {
+		return fmt.Errorf("invalid level %d", log.Level)
+	}
+
+	if len(log.ID) > maxLogIDLength {
+		return fmt.Errorf("id is longer than %d characters", maxLogIDLength)
+	}
+
+	// Loggers allow events without a message, which are only their
+	// attributes
+	if log.Message == "" && len(log.Attributes) == 0 {
+		return errors.New("message is empty")
+	}
+
+	return nil
+}
+
+// mediaType returns the media type of the request body without any
+// parameters. It is empty when no Content-Type was sent.
+func mediaType(r *http.Request) string {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return ""
+	}
+
+	got, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return header
+	}
+
+	return got
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/m4tth3/loggui/server/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUsername = "user"
+	testPassword = "pass"
+)
+
+func newTestServer() *Server {
+	return NewServer(testUsername, testPassword, storage.NewLogManager(100, nil))
+}
+
+func doRequest(s *Server, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.SetBasicAuth(testUsername, testPassword)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIngest_Single(t *testing.T) {
+	s := newTestServer()
+
+	rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/json",
+		`{"level": 2, "message": "hello"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ingestResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Accepted)
+	assert.Equal(t, 0, resp.Rejected)
+	assert.Equal(t, []ingestResult{{Index: 0, Status: ingestAccepted}}, resp.Results)
+}
+
+func TestIngest_LevelNames(t *testing.T) {
+	s := newTestServer()
+
+	rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/json",
+		`[{"level": "warning", "message": "named"}, {"level": "loud", "message": "unknown"}]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ingestResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Accepted)
+	assert.Equal(t, 1, resp.Rejected)
+
+	// Levels are sent back by name
+	rec = doRequest(s, http.MethodGet, "/api/v1/logs?level=warn", "", "")
+	assert.Contains(t, rec.Body.String(), `"level":"warn"`)
+}
+
+func TestIngest_Attributes(t *testing.T) {
+	s := newTestServer()
+
+	rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/json",
+		`[{"level": 2, "message": "", "attributes": {"status": 200}}, {"level": 2, "message": "", "attributes": {}}]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A log needs a message or attributes
+	var resp ingestResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Accepted)
+	assert.Equal(t, ingestAccepted, resp.Results[0].Status)
+
+	logs := queryLogs(t, s, url.Values{"attr": {"status:200"}}).Logs
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, map[string]any{"status": float64(200)}, logs[0].Attributes)
+	}
+}
+
+func TestIngest_Duplicate(t *testing.T) {
+	s := newTestServer()
+	body := `[{"id": "0190b7a4-7b5e-7c3a-9f00-000000000001", "level": 2, "message": "retried"}, {"level": 2, "message": "new"}]`
+
+	// Sending a batch again only stores the logs with an ID once
+	for _, status := range []string{ingestAccepted, ingestDuplicate} {
+		rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/json", body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp ingestResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, 2, resp.Accepted)
+		assert.Equal(t, status, resp.Results[0].Status)
+		assert.Equal(t, ingestAccepted, resp.Results[1].Status)
+	}
+
+	stored := queryLogs(t, s, url.Values{})
+	assert.Equal(t, []string{"new", "new", "retried"}, queryMessages(stored))
+
+	// Logs sent without an ID are given one
+	logs := stored.Logs
+	assert.NotEmpty(t, logs[0].ID)
+	assert.NotEqual(t, logs[0].ID, logs[1].ID)
+
+	rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/json",
+		`{"id": "`+strings.Repeat("x", maxLogIDLength+1)+`", "level": 2, "message": "long"}`)
+
+	var resp ingestResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Rejected)
+}
+
+func TestIngest_BatchPartialFailure(t *testing.T) {
+	s := newTestServer()
+
+	rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/json", `[
+		{"level": 1, "message": "first"},
+		{"level": 42, "message": "bad level"},
+		{"level": 3, "message": ""},
+		{"level": "nope"},
+		{"level": 4, "message": "last"}
+	]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ingestResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Accepted)
+	assert.Equal(t, 3, resp.Rejected)
+	assert.Len(t, resp.Results, 5)
+
+	expected := []string{ingestAccepted, ingestRejected, ingestRejected, ingestRejected, ingestAccepted}
+	for i, status := range expected {
+		assert.Equal(t, i, resp.Results[i].Index)
+		assert.Equal(t, status, resp.Results[i].Status)
+		assert.Equal(t, status == ingestRejected, resp.Results[i].Error != "")
+	}
+}
+
+func TestIngest_Malformed(t *testing.T) {
+	s := newTestServer()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"empty body", "application/json", "", http.StatusBadRequest, "malformed_payload"},
+		{"empty array", "application/json", "[]", http.StatusBadRequest, "malformed_payload"},
+		{"invalid json", "application/json", `[{"level": 1,`, http.StatusBadRequest, "malformed_payload"},
+		{"not an object", "application/json", `"hello"`, http.StatusBadRequest, "malformed_payload"},
+		{"wrong content type", "text/plain", `{}`, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(s, http.MethodPost, "/api/v1/logs", tt.contentType, tt.body)
+			assert.Equal(t, tt.status, rec.Code)
+
+			var resp apiError
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Error.Code)
+			assert.NotEmpty(t, resp.Error.Message)
+		})
+	}
+}
+
+func TestIngest_Unauthorized(t *testing.T) {
+	s := newTestServer()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/logs", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestIngest_BearerToken(t *testing.T) {
+	s := NewServerWithConfig(Config{Username: testUsername, Password: testPassword, Tokens: []string{"secret"}},
+		storage.NewLogManager(100, nil))
+
+	for token, code := range map[string]int{"secret": http.StatusOK, "wrong": http.StatusUnauthorized, "": http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/logs", strings.NewReader(`{"level": 2, "message": "hello"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		assert.Equal(t, code, rec.Code, token)
+	}
+
+	// Basic auth is still accepted alongside the tokens
+	rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/json", `{"level": 2, "message": "hello"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestIngest_NDJSON(t *testing.T) {
+	s := newTestServer()
+
+	body := strings.Join([]string{
+		`{"level": 1, "message": "first"}`,
+		``,
+		`{"level": 2, "message": "second"}`,
+		`{"level": 2, "message": `,
+		`{"level": 9, "message": "bad level"}`,
+		`{"level": 3, "message": "last"}`,
+	}, "\n")
+
+	rec := doRequest(s, http.MethodPost, "/api/v1/logs", "application/x-ndjson", body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ndjsonResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 3, resp.Accepted)
+	assert.Equal(t, []int{4}, resp.Malformed)
+	assert.Len(t, resp.Rejected, 1)
+	assert.Equal(t, 5, resp.Rejected[0].Line)
+}
+
+func TestReadLine_TooLong(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader("short\n"+strings.Repeat("x", 64)+"\nnext"), 16)
+
+	line, err := readLine(reader, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "short", string(line))
+
+	_, err = readLine(reader, 10)
+	assert.ErrorIs(t, err, errLineTooLong)
+
+	line, err = readLine(reader, 10)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, "next", string(line))
+}
+
+func TestIngest_Gzip(t *testing.T) {
+	s := newTestServer()
+
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	_, _ = zw.Write([]byte(`[{"level": 1, "message": "a"}, {"level": 2, "message": "b"}]`))
+	assert.NoError(t, zw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/logs", buf)
+	req.SetBasicAuth(testUsername, testPassword)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ingestResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Accepted)
+}
@@ -1,6 +1,10 @@
 package server
 
-import "net/http"
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
 
 // middleware is an interface to wrap http handlers with middleware.
 type middleware interface {
@@ -10,23 +14,25 @@ type middleware interface {
 	wrap(next ctxHandler) ctxHandler
 }
 
-// BasicAuthMiddleware is a middleware that adds basic authentication to the handler.
-type basicAuthMiddleware struct {
+// authMiddleware is a middleware that requires basic authentication, or a
+// bearer token, on every request.
+type authMiddleware struct {
 	username string
 	password string
+	tokens   []string
 }
 
-func newBasicAuthMiddleware(username, password string) *basicAuthMiddleware {
-	return &basicAuthMiddleware{
-		username: username,
-		password: password,
+func newAuthMiddleware(config Config) *authMiddleware {
+	return &authMiddleware{
+		username: config.Username,
+		password: config.Password,
+		tokens:   config.Tokens,
 	}
 }
 
-func (m *basicAuthMiddleware) wrap(next ctxHandler) ctxHandler {
+func (m *authMiddleware) wrap(next ctxHandler) ctxHandler {
 	return ctxHandlerFunc(func(c *context) {
-		username, password, ok := c.BasicAuth()
-		if !ok || username != m.username || password != m.password {
+		if !m.authorized(c.Request) {
 			http.Error(c.ResponseWriter, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -35,4 +41,21 @@ func (m *basicAuthMiddleware) wrap(next ctxHandler) ctxHandler {
 	})
 }
 
+// authorized reports whether the request carries a bearer token, or the
+// username and password. The values are compared in constant time.
+func (m *authMiddleware) authorized(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, t := range m.tokens {
+			if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				return true
+			}
+		}
+
+		return false
+	}
 
+	username, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(m.username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(m.password)) == 1
+}
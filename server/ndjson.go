@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/m4tth3/loggui/server/storage"
+)
+
+const (
+	// maxNDJSONLineSize is the largest single line accepted in an NDJSON
+	// stream. Longer lines are reported as malformed and skipped.
+	maxNDJSONLineSize = 1 << 20
+)
+
+var errLineTooLong = errors.New("line too long")
+
+type lineResult struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ndjsonResponse summarises an NDJSON stream once it has been fully read.
+// Line numbers start at 1 and blank lines are ignored. Duplicate logs are
+// counted as accepted.
+type ndjsonResponse struct {
+	Accepted  int          `json:"accepted"`
+	Rejected  []lineResult `json:"rejected"`
+	Malformed []int        `json:"malformed"`
+}
+
+// serveNDJSON reads one core.Log per line and stores each as soon as it is
+// decoded. The body is never buffered as a whole; when the LogManager is
+// busy, store blocks and we stop reading from the connection.
+func (h *ingestHandler) serveNDJSON(c *context) {
+	resp := ndjsonResponse{
+		Rejected:  []lineResult{},
+		Malformed: []int{},
+	}
+
+	reader := bufio.NewReader(c.Body)
+	for line := 1; ; line++ {
+		if err := c.Context().Err(); err != nil {
+			return
+		}
+
+		raw, err := readLine(reader, maxNDJSONLineSize)
+		if errors.Is(err, errLineTooLong) {
+			resp.Malformed = append(resp.Malformed, line)
+			continue
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			c.writeError(http.StatusBadRequest, "read_failed", err.Error())
+			return
+		}
+
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 {
+			if log, decodeErr := decodeLog(raw); decodeErr != nil {
+				resp.Malformed = append(resp.Malformed, line)
+			} else if storeErr := h.store(log, time.Now()); storeErr != nil && !errors.Is(storeErr, storage.ErrDuplicate) {
+				resp.Rejected = append(resp.Rejected, lineResult{Line: line, Error: storeErr.Error()})
+			} else {
+				resp.Accepted++
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	c.writeJSON(http.StatusOK, resp)
+}
+
+// readLine reads up to and excluding the next newline. If the line is longer
+// than max, the rest of it is discarded and errLineTooLong is returned.
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > max+1 {
+			return nil, discardLine(r, err)
+		}
+
+		line = append(line, chunk...)
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err != nil:
+			return line, err
+		default:
+			return bytes.TrimSuffix(line, []byte{'\n'}), nil
+		}
+	}
+}
+
+// discardLine skips the remainder of the current line. err is the error of
+// the last read, which may already have reached the end of the line.
+func discardLine(r *bufio.Reader, err error) error {
+	for errors.Is(err, bufio.ErrBufferFull) {
+		_, err = r.ReadSlice('\n')
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return errLineTooLong
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/m4tth3/loggui/server/storage"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+type queryResponse struct {
+	Logs []*core.Log `json:"logs"`
+
+	// NextCursor pages to older logs and PrevCursor to newer ones
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// queryHandler serves pages of logs, newest first, matching a filter built
+// from the query parameters:
+//
+//	level      - a single level, by name or number
+//	min_level  - the least severe level
+//	source     - a substring of the source
+//	group      - a substring of the group
+//	message    - a regex matched against the message
+//	trace_id   - the W3C trace ID, matched exactly
+//	span_id    - the W3C span ID, matched exactly
+//	since      - logs received at or after, RFC 3339
+//	until      - logs received at or before, RFC 3339
+//	attr       - key, for logs with the attribute, or key:value for those
+//	             where it equals value; repeat for several attributes
+//	limit      - the page size, up to 1000
+//	cursor     - a next_cursor or prev_cursor from a previous page
+//
+// A prev_cursor is returned with every page that has logs, so it can also
+// be used to poll for new ones.
+//
+// GET /api/v1/logs
+type queryHandler struct {
+	manager *storage.LogManager
+}
+
+func newQueryHandler(manager *storage.LogManager) *queryHandler {
+	return &queryHandler{manager: manager}
+}
+
+func (h *queryHandler) serveHTTP(c *context) {
+	query := c.URL.Query()
+
+	req, err := parsePageRequest(query)
+	if err != nil {
+		c.writeError(http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, direction, err := decodeCursor(raw)
+		if err != nil {
+			c.writeError(http.StatusBadRequest, "invalid_cursor", err.Error())
+			return
+		}
+
+		req.Cursor = &cursor
+		req.Direction = direction
+	}
+
+	page, err := h.manager.Page(c.Request.Context(), *req)
+	if err != nil {
+		c.writeError(http.StatusInternalServerError, "query_failed", err.Error())
+		return
+	}
+
+	resp := queryResponse{Logs: page.Logs}
+	if resp.Logs == nil {
+		resp.Logs = []*core.Log{}
+	}
+
+	if n := len(page.Logs); n > 0 {
+		resp.PrevCursor = encodeCursor(*page.Logs[0].ReceivedAt, storage.Newer)
+
+		if page.More || req.Direction == storage.Newer {
+			resp.NextCursor = encodeCursor(*page.Logs[n-1].ReceivedAt, storage.Older)
+		}
+	} else if req.Direction == storage.Newer {
+		// Nothing new yet, poll again from the same place
+		resp.PrevCursor = encodeCursor(*req.Cursor, storage.Newer)
+	}
+
+	c.writeJSON(http.StatusOK, resp)
+}
+
+// parsePageRequest maps the query parameters onto a PageRequest. The filter
+// is validated so that a bad regex is reported rather than panicking.
+func parsePageRequest(query url.Values) (*storage.PageRequest, error) {
+	req := &storage.PageRequest{Filter: &database.Filter{}, Limit: defaultQueryLimit}
+	filter := req.Filter
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxQueryLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxQueryLimit)
+		}
+		req.Limit = limit
+	}
+
+	for _, param := range []string{"level", "min_level"} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+
+		level, err := parseLevel(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", param, err)
+		}
+
+		if filter.Level == nil {
+			filter.Level = &database.FieldFilter[core.Level]{}
+		}
+
+		if param == "level" {
+			filter.Level.Eq = &level
+		} else {
+			filter.Level.Ge = &level
+		}
+	}
+
+	for param, field := range map[string]**database.FieldFilter[string]{
+		"source":   &filter.Source,
+		"group":    &filter.Group,
+		"message":  &filter.Message,
+		"trace_id": &filter.TraceID,
+		"span_id":  &filter.SpanID,
+	} {
+		if raw := query.Get(param); raw != "" {
+			*field = database.NewStringFilter(&raw)
+		}
+	}
+
+	var since, until *time.Time
+	for param, target := range map[string]**time.Time{"since": &since, "until": &until} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 time", param)
+		}
+		*target = &t
+	}
+
+	if since != nil || until != nil {
+		filter.ReceivedAt = database.NewTimeFilter(nil, until, since)
+	}
+
+	for _, raw := range query["attr"] {
+		filter.Attributes = append(filter.Attributes, parseAttribute(raw))
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// parseLevel reads a level by its name, an alias, e.g. "warning", or its
+// number. Only the levels which are defined are accepted.
+func parseLevel(raw string) (core.Level, error) {
+	level, err := core.ParseLevel(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	if !level.Valid() {
+		return 0, fmt.Errorf("unknown level %d", level)
+	}
+
+	return level, nil
+}
+
+// parseAttribute reads an attribute filter, key or key:value. The value is
+// read as JSON if it is valid JSON, so status:200 matches the number and
+// status:"200" the string, and as a string otherwise, e.g. user:bob.
+func parseAttribute(raw string) database.AttributeFilter {
+	key, rawValue, ok := strings.Cut(raw, ":")
+	if !ok {
+		return database.AttributeFilter{Key: key}
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(rawValue), &value); err != nil {
+		value = rawValue
+	}
+
+	return database.AttributeFilter{Key: key, Value: value}
+}
+
+// Cursors are the ReceivedAt of the log a page starts after, in
+// microseconds, with the direction to read in. They are base64 encoded so
+// that clients treat them as opaque.
+
+var errInvalidCursor = errors.New("cursor is not valid")
+
+func encodeCursor(t time.Time, direction storage.PageDirection) string {
+	prefix := "o"
+	if direction == storage.Newer {
+		prefix = "n"
+	}
+
+	raw := prefix + strconv.FormatInt(t.UnixMicro(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, storage.PageDirection, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) < 2 {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	var direction storage.PageDirection
+	switch raw[0] {
+	case 'o':
+		direction = storage.Older
+	case 'n':
+		direction = storage.Newer
+	default:
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	micro, err := strconv.ParseInt(string(raw[1:]), 10, 64)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	return time.UnixMicro(micro), direction, nil
+}
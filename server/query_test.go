@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func queryLogs(t *testing.T, s *Server, params url.Values) queryResponse {
+	rec := doRequest(s, http.MethodGet, "/api/v1/logs?"+params.Encode(), "", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp queryResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func queryMessages(resp queryResponse) []string {
+	var out []string
+	for _, log := range resp.Logs {
+		out = append(out, log.Message)
+	}
+	return out
+}
+
+func TestQuery_Pagination(t *testing.T) {
+	s := newTestServer()
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, s.manager.Write(&core.Log{Level: core.INFO, Message: fmt.Sprint(i)}))
+	}
+
+	first := queryLogs(t, s, url.Values{"limit": {"2"}})
+	assert.Equal(t, []string{"5", "4"}, queryMessages(first))
+	assert.NotEmpty(t, first.NextCursor)
+
+	second := queryLogs(t, s, url.Values{"limit": {"2"}, "cursor": {first.NextCursor}})
+	assert.Equal(t, []string{"3", "2"}, queryMessages(second))
+
+	last := queryLogs(t, s, url.Values{"limit": {"2"}, "cursor": {second.NextCursor}})
+	assert.Equal(t, []string{"1"}, queryMessages(last))
+	assert.Empty(t, last.NextCursor)
+
+	back := queryLogs(t, s, url.Values{"limit": {"2"}, "cursor": {last.PrevCursor}})
+	assert.Equal(t, []string{"3", "2"}, queryMessages(back))
+
+	// Polling from the newest page returns nothing until a new log arrives
+	poll := queryLogs(t, s, url.Values{"cursor": {first.PrevCursor}})
+	assert.Empty(t, poll.Logs)
+	assert.Equal(t, first.PrevCursor, poll.PrevCursor)
+
+	assert.NoError(t, s.manager.Write(&core.Log{Level: core.INFO, Message: "6"}))
+	poll = queryLogs(t, s, url.Values{"cursor": {poll.PrevCursor}})
+	assert.Equal(t, []string{"6"}, queryMessages(poll))
+}
+
+func TestQuery_Filter(t *testing.T) {
+	s := newTestServer()
+	api, worker := "api", "worker"
+	trace := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	for _, log := range []*core.Log{
+		{Level: core.INFO, Source: &api, Message: "started", Attributes: map[string]any{"port": 8080.0}},
+		{Level: core.ERROR, Source: &api, Message: "failed to connect", Attributes: map[string]any{"host": "db"}},
+		{Level: core.WARN, Source: &worker, Message: "slow job", TraceID: &trace},
+		{Level: core.FATAL, Source: &worker, Message: "failed to start"},
+	} {
+		assert.NoError(t, s.manager.Write(log))
+	}
+
+	tests := []struct {
+		params   url.Values
+		expected []string
+	}{
+		{url.Values{"level": {"error"}}, []string{"failed to connect"}},
+		{url.Values{"level": {"critical"}}, []string{"failed to start"}},
+		{url.Values{"min_level": {"warn"}}, []string{"failed to start", "slow job", "failed to connect"}},
+		{url.Values{"source": {"work"}}, []string{"failed to start", "slow job"}},
+		{url.Values{"message": {"^failed"}, "source": {"api"}}, []string{"failed to connect"}},
+		{url.Values{"until": {time.Now().Add(-time.Hour).Format(time.RFC3339)}}, nil},
+		{url.Values{"trace_id": {trace}}, []string{"slow job"}},
+		{url.Values{"attr": {"port"}}, []string{"started"}},
+		{url.Values{"attr": {"port:8080"}}, []string{"started"}},
+		{url.Values{"attr": {`port:"8080"`}}, nil},
+		{url.Values{"attr": {"host:db"}}, []string{"failed to connect"}},
+		{url.Values{"attr": {"host:db", "port"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.params.Encode(), func(t *testing.T) {
+			assert.Equal(t, tt.expected, queryMessages(queryLogs(t, s, tt.params)))
+		})
+	}
+}
+
+func TestQuery_InvalidParameters(t *testing.T) {
+	s := newTestServer()
+
+	for target, code := range map[string]string{
+		"/api/v1/logs?message=(":       "invalid_parameter",
+		"/api/v1/logs?level=loud":      "invalid_parameter",
+		"/api/v1/logs?limit=0":         "invalid_parameter",
+		"/api/v1/logs?since=yesterday": "invalid_parameter",
+		"/api/v1/logs?cursor=nope":     "invalid_cursor",
+		"/api/v1/logs?attr=":           "invalid_parameter",
+	} {
+		rec := doRequest(s, http.MethodGet, target, "", "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+
+		var resp apiError
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, code, resp.Error.Code, target)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	now := time.Now().Truncate(time.Microsecond)
+
+	for _, direction := range []storage.PageDirection{storage.Older, storage.Newer} {
+		got, gotDirection, err := decodeCursor(encodeCursor(now, direction))
+		assert.NoError(t, err)
+		assert.True(t, now.Equal(got))
+		assert.Equal(t, direction, gotDirection)
+	}
+}
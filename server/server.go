@@ -1,6 +1,10 @@
 package server
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/m4tth3/loggui/server/storage"
+)
 
 // This package provides a simple HTTP server to serve the static files
 // and also handle client requests.
@@ -8,24 +12,45 @@ import "net/http"
 // Server is the main wrapper for all the loggui server functionality.
 // It contains the HTTP handler and any other server related
 //
-// The server will use add the following endpoints: T.B.A.
+// The server will use add the following endpoints:
+//
+//	POST /api/v1/logs - ingest a log or a batch of logs
+//	GET  /api/v1/logs - query pages of logs, newest first
+//	GET  /api/v1/logs/stream - tail the logs as Server-Sent Events
+//	GET  /api/v1/logs/ws - tail and page through the logs over a websocket
 type Server struct {
-	username string
-	password string
+	config Config
+
+	manager *storage.LogManager
 
 	http.Handler
 }
 
-func NewServer(username, password string) *Server {
+// Config holds the credentials a Server accepts. Every request must send
+// either Username and Password as basic auth, or one of Tokens as a bearer
+// token.
+type Config struct {
+	Username string
+	Password string
+	Tokens   []string
+}
+
+// NewServer creates a server accepting only the username and password.
+func NewServer(username, password string, manager *storage.LogManager) *Server {
+	return NewServerWithConfig(Config{Username: username, Password: password}, manager)
+}
+
+// NewServerWithConfig creates a server accepting the credentials of config.
+func NewServerWithConfig(config Config, manager *storage.LogManager) *Server {
 	handler := newMux()
 	s := &Server{
-		username: username,
-		password: password,
-		Handler:  handler,
+		config:  config,
+		manager: manager,
+		Handler: handler,
 	}
 
-	for _, m := range []middleware {
-		newBasicAuthMiddleware(username, password),
+	for _, m := range []middleware{
+		newAuthMiddleware(config),
 	} {
 		handler.use(m)
 	}
@@ -35,6 +60,10 @@ func NewServer(username, password string) *Server {
 	handler.Handle("/static/", http.StripPrefix("/static/", fs))
 
 	// Serve the api endpoints
+	handler.handle("POST /api/v1/logs", newIngestHandler(manager))
+	handler.handle("GET /api/v1/logs", newQueryHandler(manager))
+	handler.handle("GET /api/v1/logs/stream", newStreamHandler(manager))
+	handler.handle("GET /api/v1/logs/ws", newWebsocketHandler(manager))
 
 	return s
 }
@@ -3,7 +3,6 @@ package storage
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/m4tth3/loggui/core"
 	"github.com/m4tth3/loggui/server/database"
 	"sync"
@@ -17,42 +16,96 @@ type Filter = database.Filter
 
 const (
 	CacheSize = 50
+
+	// FilterCacheCount is the number of filters whose recent logs are
+	// cached, and FilterCacheSize the number of logs cached for each.
+	FilterCacheCount = 8
+	FilterCacheSize  = CacheSize * 4
 )
 
+// filterCache holds the newest logs matching a filter. It is populated from
+// the main buffer when created and kept up to date by every write after.
 type filterCache struct {
 	filter *Filter
 	cache  *RingBuffer[Log]
 }
 
+// ErrDuplicate is returned by LogManager.Write for a log with the ID of one
+// written recently. The log is not written again.
+var ErrDuplicate = errors.New("log is a duplicate")
+
+// readerQueueSize is the number of chunk requests a LogReader queues
+const readerQueueSize = 16
+
+// LogChunk is a chunk of up to CacheSize logs read by a LogReader, newest
+// first. Last is set when there are no older logs, and Err if the chunk
+// could not be read.
+type LogChunk struct {
+	Chunk Chunk
+	Logs  []*Log
+	Last  bool
+	Err   error
+}
+
+// LogReader reads the logs matching its filter in chunks of CacheSize,
+// newest first. Chunk 0 holds the newest logs at the time the reader was
+// created, so logs written afterwards never shift the chunks.
 type LogReader struct {
 	count   uint64
 	req     chan Chunk
 	filter  *Filter
 	manager *LogManager
 
+	// cache is the filter's cache, or nil if the filter cannot be cached
+	cache     *filterCache
+	countOnce sync.Once
+	countErr  error
+
+	// anchor is the cursor chunk 0 is read from. cursors[i] is the cursor
+	// of chunk i, filled in as the chunks are read.
+	anchor  time.Time
+	cursors []time.Time
+	done    chan struct{}
+
 	once atomic.Int32
 }
 
-func (s *LogReader) Count() uint64 {
-	return s.count
+// Count returns the number of logs matching the filter which were received
+// before the anchor. It is counted on the first call, along with those in
+// the database, and an error counting them is returned by every call.
+func (s *LogReader) Count() (uint64, error) {
+	s.countOnce.Do(func() {
+		s.count, s.countErr = s.manager.count(context.Background(), s.filter, s.anchor)
+	})
+
+	return s.count, s.countErr
 }
 
-func (s *LogReader) OpenStream(ctx context.Context) (<-chan *Log, error) {
+// Anchor returns the time the reader was anchored at. Only logs received
+// before it are read.
+func (s *LogReader) Anchor() time.Time {
+	return s.anchor
+}
+
+// OpenStream starts serving the chunks requested with RequestChunk, in the
+// order they were requested. The channel is closed once ctx is done.
+func (s *LogReader) OpenStream(ctx context.Context) (<-chan *LogChunk, error) {
 	if !s.once.CompareAndSwap(0, 1) {
 		return nil, errors.New("stream already started")
 	}
 
-	out := make(chan *Log)
+	out := make(chan *LogChunk)
 
 	go func() {
 		defer close(out)
+		defer close(s.done)
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case chunk := <-s.req:
-				if !s.readChunk(chunk, s.filter, out) {
+				if !s.readChunk(ctx, chunk, s.filter, out) {
 					return
 				}
 			}
@@ -62,23 +115,104 @@ func (s *LogReader) OpenStream(ctx context.Context) (<-chan *Log, error) {
 	return out, nil
 }
 
+// RequestChunk queues a chunk to be read. It returns once the request is
+// queued, or straight away if the stream has been closed.
 func (s *LogReader) RequestChunk(chunk Chunk) {
 	if s.req == nil {
 		panic("request channel is nil")
 	}
 
-	s.req <- chunk
+	select {
+	case s.req <- chunk:
+	case <-s.done:
+	}
 }
 
-func (s *LogReader) readChunk(chunk Chunk, filter *Filter, out chan<- *Log) bool {
-	// First attempt to find the cache. Note cache should be small
-	for el := s.manager.caches.Element(); el != nil; el = el.Next(0) {
-		if filter.Equal(el.Value().filter) {
+// readChunk reads the chunk and sends it to out. It reports whether the
+// stream should carry on.
+func (s *LogReader) readChunk(ctx context.Context, chunk Chunk, filter *Filter, out chan<- *LogChunk) bool {
+	c := s.readCachedChunk(chunk)
+	if c == nil {
+		c = s.readPagedChunk(ctx, chunk, filter)
+	}
 
+	select {
+	case out <- c:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// readCachedChunk reads the chunk from the filter cache. It returns nil if
+// the cache does not reach back far enough to tell the chunk is complete.
+func (s *LogReader) readCachedChunk(chunk Chunk) *LogChunk {
+	if s.cache == nil {
+		return nil
+	}
+
+	// Skip the logs written since the reader was anchored
+	el := s.cache.cache.Element()
+	for el != nil && !el.Value().ReceivedAt.Before(s.anchor) {
+		el = el.Next(0)
+	}
+
+	if skip := chunk * CacheSize; el != nil && skip > 0 {
+		if skip >= uint64(s.cache.cache.Capacity()) {
+			return nil
 		}
+		el = el.Next(uint(skip - 1))
+	}
+
+	// One log more than the chunk tells whether there are older ones
+	logs := make([]*Log, 0, CacheSize+1)
+	for ; el != nil && len(logs) <= CacheSize; el = el.Next(0) {
+		logs = append(logs, el.Value())
 	}
 
-	return true
+	if len(logs) <= CacheSize {
+		return nil
+	}
+
+	logs = logs[:CacheSize]
+	if Chunk(len(s.cursors)) == chunk+1 {
+		s.cursors = append(s.cursors, *logs[CacheSize-1].ReceivedAt)
+	}
+
+	return &LogChunk{Chunk: chunk, Logs: logs}
+}
+
+// readPagedChunk reads the chunk through LogManager.Page, from the buffer
+// and the database.
+func (s *LogReader) readPagedChunk(ctx context.Context, chunk Chunk, filter *Filter) *LogChunk {
+	c := &LogChunk{Chunk: chunk}
+
+	// A chunk starts where the one before it ends, so any chunks skipped
+	// over are read first to find where the requested one starts
+	for n := min(chunk, Chunk(len(s.cursors)-1)); ; n++ {
+		page, err := s.manager.Page(ctx, PageRequest{
+			Filter: filter,
+			Cursor: &s.cursors[n],
+			Limit:  CacheSize,
+		})
+		if err != nil {
+			c.Err = err
+			return c
+		}
+
+		if page.More && Chunk(len(s.cursors)) == n+1 {
+			s.cursors = append(s.cursors, *page.Logs[len(page.Logs)-1].ReceivedAt)
+		}
+
+		if n == chunk {
+			c.Logs = page.Logs
+		}
+
+		if n == chunk || !page.More {
+			c.Last = !page.More
+			return c
+		}
+	}
 }
 
 // LogManager is the main storage manager for logs
@@ -93,45 +227,273 @@ type LogManager struct {
 	caches    *RingBuffer[filterCache]
 	buffer    *RingBuffer[Log]
 	writeLock sync.Mutex
+
+	// seen holds the last logs written with an ID, so that a log sent again
+	// is dropped. Protected by writeLock.
+	seen *FixedHashSet[*Log]
+
+	// db holds the logs which no longer fit in the buffer. It may be nil,
+	// in which case only the buffer is kept.
+	db database.QueryHandler
+
+	// lastReceivedAt is the ReceivedAt of the last write, or the time the
+	// manager was created. Protected by writeLock, as is closed.
+	lastReceivedAt time.Time
+	closed         bool
+
+	// queueing counts the writes waiting for room in writeChannel, which
+	// is only closed once they are done
+	queueing sync.WaitGroup
+
+	// config, persistDone and aborted are used by persist, which writes the
+	// logs from writeChannel to db until it is closed
+	config      PersistConfig
+	persistDone chan struct{}
+	aborted     context.Context
+	abort       context.CancelFunc
+
+	// pending holds the logs queued to be persisted which are not in db
+	// yet, so that count finds those no longer in the buffer. persist holds
+	// persistLock while writing to db, and count while reading both, so
+	// each log is seen in exactly one of them.
+	pending     map[*Log]struct{}
+	pendingLock sync.Mutex
+	persistLock sync.RWMutex
+
+	persisted    atomic.Uint64
+	retried      atomic.Uint64
+	deadLettered atomic.Uint64
 }
 
-func NewLogManager(size uint) *LogManager {
+// NewLogManager creates a manager keeping the last size logs in memory. If
+// db is not nil every log written is also persisted to it, with the
+// default PersistConfig.
+func NewLogManager(size uint, db database.QueryHandler) *LogManager {
+	return NewLogManagerWithConfig(size, db, PersistConfig{})
+}
+
+// NewLogManagerWithConfig creates a manager like NewLogManager, persisting
+// to db as configured.
+func NewLogManagerWithConfig(size uint, db database.QueryHandler, config PersistConfig) *LogManager {
+	config = config.withDefaults(size)
+	aborted, abort := context.WithCancel(context.Background())
 
 	l := &LogManager{
 		size:         uint64(size),
-		writeChannel: make(chan *Log, size),
+		writeChannel: make(chan *Log, config.QueueSize),
+		caches:       NewRingBuffer[filterCache](FilterCacheCount),
 		buffer:       NewRingBuffer[Log](size),
+		seen:         NewFixedHashSet[*Log](int(size)),
+		db:           db,
+
+		lastReceivedAt: time.Now().Truncate(time.Microsecond),
+
+		config:      config,
+		persistDone: make(chan struct{}),
+		pending:     map[*Log]struct{}{},
+		aborted:     aborted,
+		abort:       abort,
 	}
 
-	go l.processWriteChannel()
+	if db != nil {
+		go l.persist()
+	}
 
 	return l
 }
 
-func (l *LogManager) GetReader() *LogReader {
-	return &LogReader{}
+// GetReader returns a reader of the logs matching the filter, anchored at
+// the last write.
+func (l *LogManager) GetReader(filter *Filter) *LogReader {
+	if filter == nil {
+		filter = &Filter{}
+	}
+
+	// A filter which does not validate is not cached, as it would fail
+	// every write. The reader reports the error on reading instead.
+	valid := filter.Validate() == nil
+
+	l.writeLock.Lock()
+	anchor := l.lastReceivedAt.Add(time.Microsecond)
+
+	var cache *filterCache
+	if valid {
+		cache = l.cacheFor(filter)
+	}
+	l.writeLock.Unlock()
+
+	return &LogReader{
+		req:     make(chan Chunk, readerQueueSize),
+		filter:  filter,
+		manager: l,
+		cache:   cache,
+		anchor:  anchor,
+		cursors: []time.Time{anchor},
+		done:    make(chan struct{}),
+	}
+}
+
+// cacheFor returns the cache of the filter, creating it from the buffer if
+// there is none. The least recently created cache is dropped to make room.
+//
+// The caller must hold writeLock, so no write is missed while populating.
+func (l *LogManager) cacheFor(filter *Filter) *filterCache {
+	for el := l.caches.Element(); el != nil; el = el.Next(0) {
+		if filter.Equal(el.Value().filter) {
+			return el.Value()
+		}
+	}
+
+	var logs []*Log
+	for el := l.buffer.Element(); el != nil && len(logs) < FilterCacheSize; el = el.Next(0) {
+		if filter.Filter(el.Value()) {
+			logs = append(logs, el.Value())
+		}
+	}
+
+	cache := &filterCache{
+		filter: filter,
+		cache:  NewRingBuffer[Log](FilterCacheSize),
+	}
+
+	for i := len(logs) - 1; i >= 0; i-- {
+		cache.cache.Write(logs[i])
+	}
+
+	l.caches.Write(cache)
+	return cache
+}
+
+// count counts the logs matching the filter received before the time, in
+// the buffer, then those older still waiting to be persisted and, with a
+// single count, the database.
+func (l *LogManager) count(ctx context.Context, filter *Filter, before time.Time) (uint64, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	var count uint64
+	oldest := before
+
+	for el := l.buffer.Element(); el != nil; el = el.Next(0) {
+		log := el.Value()
+		oldest = *log.ReceivedAt
+
+		if log.ReceivedAt.Before(before) && filter.Filter(log) {
+			count++
+		}
+	}
+
+	if l.db == nil {
+		return count, nil
+	}
+
+	cursor := oldest
+	if before.Before(oldest) {
+		cursor = before
+	}
+
+	l.persistLock.RLock()
+	defer l.persistLock.RUnlock()
+
+	l.pendingLock.Lock()
+	for log := range l.pending {
+		if log.ReceivedAt.Before(cursor) && filter.Filter(log) {
+			count++
+		}
+	}
+	l.pendingLock.Unlock()
+
+	older, err := l.db.CountLogs(ctx, &database.Query{
+		Filter: filter,
+		Order:  database.Descending,
+		Cursor: &cursor,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count + older, nil
+}
+
+// Subscribe returns the newest log in the buffer and a channel receiving
+// every log written after it. The channel is closed once ctx is done, or
+// early if the subscriber falls ListenerBufferSize logs behind.
+func (l *LogManager) Subscribe(ctx context.Context) (*Element[Log], <-chan *Log) {
+	return l.buffer.ElementAndListener(ctx)
 }
 
 // Write writes the log to the storage. We will store based on date received
-// and then use a ring buffer to Cache the logs
+// and then use a ring buffer to Cache the logs.
+//
+// ReceivedAt is stamped with the current time if the caller has not set it.
+// It is truncated to microseconds (the precision kept by the databases) and
+// moved forward where needed so that every write has a distinct ReceivedAt,
+// which makes it usable as a cursor.
+//
+// A log with the ID of one of the last size logs written with an ID is
+// dropped, returning ErrDuplicate, so that a client can retry safely. Older
+// duplicates are left for the database to skip.
+//
+// The log is then queued to be persisted, blocking while the queue is
+// full. writeLock is released first, so a stalled database only holds up
+// writes, not readers or Close. ErrClosed is returned once Close has been
+// called.
 func (l *LogManager) Write(log *Log) error {
 	if log == nil {
 		return errors.New("log is nil")
 	}
 
 	l.writeLock.Lock()
-	defer l.writeLock.Unlock()
 
-	log.RecordedAt = time.Now()
-	l.writeChannel <- log
+	if l.closed {
+		l.writeLock.Unlock()
+		return ErrClosed
+	}
 
-	return nil
-}
+	if log.ID != "" {
+		if el := l.seen.Get(log.Hash()); el != nil && (*el.Item()).ID == log.ID {
+			l.writeLock.Unlock()
+			return ErrDuplicate
+		}
+
+		l.seen.Add(log)
+	}
 
-func (l *LogManager) processWriteChannel() {
-	var log *Log
-	for {
-		log = <-l.writeChannel
-		fmt.Print(log)
+	receivedAt := time.Now()
+	if log.ReceivedAt != nil {
+		receivedAt = *log.ReceivedAt
 	}
+
+	receivedAt = receivedAt.Truncate(time.Microsecond)
+	if !receivedAt.After(l.lastReceivedAt) {
+		receivedAt = l.lastReceivedAt.Add(time.Microsecond)
+	}
+
+	l.lastReceivedAt = receivedAt
+	log.ReceivedAt = &receivedAt
+
+	l.buffer.Write(log)
+
+	for el := l.caches.Element(); el != nil; el = el.Next(0) {
+		if cache := el.Value(); cache.filter.Filter(log) {
+			cache.cache.Write(log)
+		}
+	}
+
+	if l.db == nil {
+		l.writeLock.Unlock()
+		return nil
+	}
+
+	l.pendingLock.Lock()
+	l.pending[log] = struct{}{}
+	l.pendingLock.Unlock()
+
+	l.queueing.Add(1)
+	l.writeLock.Unlock()
+	defer l.queueing.Done()
+
+	l.writeChannel <- log
+	return nil
 }
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLogReader_Chunks(t *testing.T) {
+	manager := NewLogManager(200, nil)
+	writeLogs(t, manager, 1, CacheSize+10)
+
+	reader := manager.GetReader(nil)
+	stream, err := reader.OpenStream(t.Context())
+	assert.NoError(t, err)
+
+	// New logs do not shift the chunks of an open reader
+	writeLogs(t, manager, 1000, 1005)
+
+	reader.RequestChunk(1)
+	reader.RequestChunk(0)
+	reader.RequestChunk(2)
+
+	chunk := <-stream
+	assert.Equal(t, Chunk(1), chunk.Chunk)
+	assert.Equal(t, []string{"10", "9", "8", "7", "6", "5", "4", "3", "2", "1"}, messages(chunk.Logs))
+	assert.True(t, chunk.Last)
+
+	chunk = <-stream
+	assert.Equal(t, Chunk(0), chunk.Chunk)
+	assert.Len(t, chunk.Logs, CacheSize)
+	assert.Equal(t, strconv.Itoa(CacheSize+10), chunk.Logs[0].Message)
+	assert.False(t, chunk.Last)
+
+	chunk = <-stream
+	assert.Empty(t, chunk.Logs)
+	assert.True(t, chunk.Last)
+
+	count, err := reader.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(CacheSize+10), count)
+
+	_, err = reader.OpenStream(t.Context())
+	assert.Error(t, err)
+}
+
+func TestLogReader_Filter(t *testing.T) {
+	manager := NewLogManager(200, nil)
+	writeLogs(t, manager, 1, 20)
+
+	pattern := "^1"
+	reader := manager.GetReader(&Filter{Message: database.NewStringFilter(&pattern)})
+	stream, _ := reader.OpenStream(t.Context())
+
+	reader.RequestChunk(0)
+	chunk := <-stream
+	assert.NoError(t, chunk.Err)
+
+	var expected []string
+	for i := 19; i >= 10; i-- {
+		expected = append(expected, fmt.Sprint(i))
+	}
+	expected = append(expected, "1")
+	assert.Equal(t, expected, messages(chunk.Logs))
+}
+
+func TestLogReader_Closed(t *testing.T) {
+	manager := NewLogManager(10, nil)
+	reader := manager.GetReader(nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	stream, _ := reader.OpenStream(ctx)
+	cancel()
+
+	for range stream {
+	}
+
+	// Requests after the stream is closed must not block
+	for range readerQueueSize + 1 {
+		reader.RequestChunk(0)
+	}
+}
+
+func TestLogReader_Cache(t *testing.T) {
+	manager := NewLogManager(1000, nil)
+	writeLogs(t, manager, 1, 300)
+
+	level := core.INFO
+	reader := manager.GetReader(&Filter{Level: database.NewLevelFilter(&level)})
+	assert.NotNil(t, reader.cache)
+
+	chunk := reader.readCachedChunk(1)
+	assert.NotNil(t, chunk)
+	assert.Equal(t, "250", chunk.Logs[0].Message)
+	assert.Len(t, chunk.Logs, CacheSize)
+
+	// Chunks past the cache are read from the buffer instead
+	assert.Nil(t, reader.readCachedChunk(FilterCacheSize/CacheSize))
+
+	// An equal filter shares the cache, which is kept up to date by writes
+	writeLogs(t, manager, 301, 310)
+	other := manager.GetReader(&Filter{Level: database.NewLevelFilter(&level)})
+	assert.Same(t, reader.cache, other.cache)
+	assert.Equal(t, "310", other.readCachedChunk(0).Logs[0].Message)
+
+	// The first reader is still anchored before the new writes
+	assert.Equal(t, "300", reader.readCachedChunk(0).Logs[0].Message)
+
+	stream, _ := other.OpenStream(t.Context())
+	other.RequestChunk(6)
+	chunk = <-stream
+	assert.Equal(t, []string{"10", "9", "8", "7", "6", "5", "4", "3", "2", "1"}, messages(chunk.Logs))
+	assert.True(t, chunk.Last)
+}
+
+func TestLogReader_CacheEviction(t *testing.T) {
+	manager := NewLogManager(10, nil)
+
+	var first *LogReader
+	for i := range FilterCacheCount + 1 {
+		source := fmt.Sprint(i)
+		reader := manager.GetReader(&Filter{Source: database.NewStringFilter(&source)})
+		if first == nil {
+			first = reader
+		}
+	}
+
+	source := "0"
+	again := manager.GetReader(&Filter{Source: database.NewStringFilter(&source)})
+	assert.NotSame(t, first.cache, again.cache)
+
+	invalid := "("
+	assert.Nil(t, manager.GetReader(&Filter{Message: database.NewStringFilter(&invalid)}).cache)
+}
+
+func TestLogReader_Count(t *testing.T) {
+	db := &testDatabase{}
+	manager := NewLogManagerWithConfig(5, db, PersistConfig{FlushInterval: time.Millisecond})
+
+	for i := 1; i <= 20; i++ {
+		level := core.INFO
+		if i%2 == 0 {
+			level = core.ERROR
+		}
+
+		log := &Log{Level: level, Message: fmt.Sprint(i)}
+		assert.NoError(t, manager.Write(log))
+		db.logs = append(db.logs, log)
+	}
+
+	// Once persisted the logs are only counted in the database
+	assert.Eventually(t, func() bool {
+		return manager.PersistStats().Persisted == 20
+	}, time.Second, time.Millisecond)
+
+	level := core.ERROR
+	reader := manager.GetReader(&Filter{Level: database.NewLevelFilter(&level)})
+	all := manager.GetReader(nil)
+
+	// Logs written after the readers were anchored are not counted
+	writeLogs(t, manager, 21, 30)
+
+	count, err := reader.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), count)
+
+	count, err = all.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), count)
+
+	// A database error is returned rather than a short count
+	db.err = errors.New("unavailable")
+	_, err = manager.GetReader(nil).Count()
+	assert.ErrorIs(t, err, db.err)
+
+	invalid := "("
+	_, err = manager.GetReader(&Filter{Message: database.NewStringFilter(&invalid)}).Count()
+	assert.Error(t, err)
+}
+
+func TestLogReader_CountPending(t *testing.T) {
+	db := &testDatabase{}
+	manager := NewLogManagerWithConfig(5, db, PersistConfig{FlushInterval: time.Hour})
+
+	// The logs which left the buffer are still waiting to be persisted, so
+	// they are neither in the buffer nor in the database
+	for i := 1; i <= 20; i++ {
+		level := core.INFO
+		if i%2 == 0 {
+			level = core.ERROR
+		}
+
+		assert.NoError(t, manager.Write(&Log{Level: level, Message: fmt.Sprint(i)}))
+	}
+
+	level := core.ERROR
+	count, err := manager.GetReader(&Filter{Level: database.NewLevelFilter(&level)}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), count)
+
+	count, err = manager.GetReader(nil).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), count)
+}
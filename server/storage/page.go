@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/m4tth3/loggui/server/database"
+)
+
+// PageDirection is the side of the cursor a page is read from.
+type PageDirection int
+
+const (
+	// Older pages hold the logs received before the cursor
+	Older PageDirection = iota
+	// Newer pages hold the logs received after the cursor
+	Newer
+)
+
+// PageRequest describes a page of logs. The cursor is the ReceivedAt of
+// the log the page starts after, and is excluded from it. Without a cursor
+// an Older page starts at the newest log.
+type PageRequest struct {
+	Filter    *Filter
+	Cursor    *time.Time
+	Direction PageDirection
+	Limit     int
+}
+
+// Page is a page of logs ordered newest first.
+//
+// More reports whether there are further logs past the page in its
+// direction.
+type Page struct {
+	Logs []*Log
+	More bool
+}
+
+// Page reads a page of logs matching the filter. They are served from the
+// buffer and, once it runs out, from the database. The database is no
+// longer read once ctx is done.
+func (l *LogManager) Page(ctx context.Context, req PageRequest) (*Page, error) {
+	if req.Limit <= 0 {
+		return nil, errors.New("limit must be > 0")
+	}
+
+	if req.Direction == Newer && req.Cursor == nil {
+		return nil, errors.New("newer pages require a cursor")
+	}
+
+	filter := req.Filter
+	if filter == nil {
+		filter = &Filter{}
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The buffer is walked from the newest log. Older pages stop once they
+	// have one log more than the limit, Newer pages once they reach the
+	// cursor, as everything past it is older still.
+	var logs []*Log
+	var oldest *time.Time
+	exhausted := true
+
+	for el := l.buffer.Element(); el != nil; el = el.Next(0) {
+		log := el.Value()
+		oldest = log.ReceivedAt
+
+		if req.Direction == Newer && !log.ReceivedAt.After(*req.Cursor) {
+			exhausted = false
+			break
+		}
+
+		if !req.contains(log.ReceivedAt) || !filter.Filter(log) {
+			continue
+		}
+
+		logs = append(logs, log)
+		if req.Direction == Older && len(logs) > req.Limit {
+			exhausted = false
+			break
+		}
+	}
+
+	if exhausted && l.db != nil {
+		older, err := l.readDatabase(ctx, req, filter, oldest)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, older...)
+	}
+
+	page := &Page{More: len(logs) > req.Limit}
+
+	switch {
+	case !page.More:
+		page.Logs = logs
+	case req.Direction == Older:
+		page.Logs = logs[:req.Limit]
+	default:
+		page.Logs = logs[len(logs)-req.Limit:]
+	}
+
+	return page, nil
+}
+
+// readDatabase reads the logs of the page which were received before the
+// oldest log in the buffer, newest first. Only as many as could be on the
+// page are read: the newest for an Older page, and those just after the
+// cursor for a Newer one.
+func (l *LogManager) readDatabase(ctx context.Context, req PageRequest, filter *Filter, oldest *time.Time) ([]*Log, error) {
+	query := &database.Query{Filter: filter, Limit: req.Limit + 1}
+
+	if req.Direction == Newer {
+		query.Cursor = req.Cursor
+
+		if oldest != nil {
+			le := oldest.Add(-time.Microsecond)
+			query.Filter = narrowReceivedAt(filter, nil, &le)
+		}
+	} else {
+		query.Order = database.Descending
+		query.Cursor = oldest
+
+		if req.Cursor != nil && (oldest == nil || req.Cursor.Before(*oldest)) {
+			query.Cursor = req.Cursor
+		}
+	}
+
+	it, err := l.db.GetLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var logs []*Log
+	for it.Next() {
+		logs = append(logs, it.Log())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	if query.Order == database.Ascending {
+		slices.Reverse(logs)
+	}
+
+	return logs, nil
+}
+
+// contains checks the time is on the requested side of the cursor.
+func (req *PageRequest) contains(t *time.Time) bool {
+	switch {
+	case req.Cursor == nil:
+		return true
+	case req.Direction == Newer:
+		return t.After(*req.Cursor)
+	default:
+		return t.Before(*req.Cursor)
+	}
+}
+
+// narrowReceivedAt returns a copy of the filter with its ReceivedAt range
+// narrowed to [ge, le].
+func narrowReceivedAt(f *Filter, ge, le *time.Time) *Filter {
+	narrowed := *f
+
+	var r database.FieldFilter[time.Time]
+	if f.ReceivedAt != nil {
+		r = *f.ReceivedAt
+	}
+
+	if ge != nil && (r.Ge == nil || ge.After(*r.Ge)) {
+		r.Ge = ge
+	}
+
+	if le != nil && (r.Le == nil || le.Before(*r.Le)) {
+		r.Le = le
+	}
+
+	if r != (database.FieldFilter[time.Time]{}) {
+		narrowed.ReceivedAt = &r
+	}
+
+	return &narrowed
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testDatabase is a QueryHandler holding the logs in memory. GetLogs fails
+// with err if it is set.
+type testDatabase struct {
+	logs []*Log
+	err  error
+}
+
+func (d *testDatabase) Init() error {
+	return nil
+}
+
+func (d *testDatabase) GetLogs(ctx context.Context, query *database.Query) (database.LogIterator, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var logs []*Log
+	for _, log := range d.logs {
+		if (query.Filter == nil || query.Filter.Filter(log)) && query.After(*log.ReceivedAt) {
+			logs = append(logs, log)
+		}
+	}
+
+	if query.Order == database.Descending {
+		slices.Reverse(logs)
+	}
+
+	if query.Limit > 0 && len(logs) > query.Limit {
+		logs = logs[:query.Limit]
+	}
+
+	return database.NewSliceIterator(logs), nil
+}
+
+func (d *testDatabase) CountLogs(ctx context.Context, query *database.Query) (uint64, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	var count uint64
+	for _, log := range d.logs {
+		if (query.Filter == nil || query.Filter.Filter(log)) && query.After(*log.ReceivedAt) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (d *testDatabase) WriteLog(log *core.Log) error {
+	return nil
+}
+
+func (d *testDatabase) WriteLogs(ctx context.Context, logs []*core.Log) error {
+	return nil
+}
+
+func messages(logs []*Log) []string {
+	var out []string
+	for _, log := range logs {
+		out = append(out, log.Message)
+	}
+	return out
+}
+
+func writeLogs(t *testing.T, manager *LogManager, from, to int) {
+	for i := from; i <= to; i++ {
+		assert.NoError(t, manager.Write(&Log{Level: core.INFO, Message: fmt.Sprint(i)}))
+	}
+}
+
+func TestLogManager_WriteReceivedAt(t *testing.T) {
+	manager := NewLogManager(10, nil)
+
+	// Logs received at the same time are still ordered
+	now := time.Now()
+	var logs []*Log
+	for range 3 {
+		log := &Log{ReceivedAt: &now}
+		assert.NoError(t, manager.Write(log))
+		logs = append(logs, log)
+	}
+
+	for i := 1; i < len(logs); i++ {
+		assert.True(t, logs[i].ReceivedAt.After(*logs[i-1].ReceivedAt))
+		assert.Equal(t, time.Microsecond, logs[i].ReceivedAt.Sub(*logs[i-1].ReceivedAt))
+	}
+}
+
+func TestLogManager_WriteDuplicate(t *testing.T) {
+	manager := NewLogManager(2, nil)
+
+	first := &Log{ID: core.NewID(), Message: "1"}
+	assert.NoError(t, manager.Write(first))
+	assert.ErrorIs(t, manager.Write(&Log{ID: first.ID, Message: "1"}), ErrDuplicate)
+
+	// Logs without an ID are never duplicates
+	assert.NoError(t, manager.Write(&Log{Message: "2"}))
+	assert.NoError(t, manager.Write(&Log{Message: "2"}))
+
+	page, err := manager.Page(context.Background(), PageRequest{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "2"}, messages(page.Logs))
+
+	// Only the IDs of the last logs are remembered
+	for i := range 2 {
+		assert.NoError(t, manager.Write(&Log{ID: core.NewID(), Message: fmt.Sprint(i)}))
+	}
+	assert.NoError(t, manager.Write(&Log{ID: first.ID, Message: "1"}))
+}
+
+func TestLogManager_Page(t *testing.T) {
+	manager := NewLogManager(10, nil)
+	writeLogs(t, manager, 1, 5)
+
+	page, err := manager.Page(context.Background(), PageRequest{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5", "4"}, messages(page.Logs))
+	assert.True(t, page.More)
+
+	page, err = manager.Page(context.Background(), PageRequest{Limit: 2, Cursor: page.Logs[1].ReceivedAt})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2"}, messages(page.Logs))
+	assert.True(t, page.More)
+
+	last, err := manager.Page(context.Background(), PageRequest{Limit: 2, Cursor: page.Logs[1].ReceivedAt})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, messages(last.Logs))
+	assert.False(t, last.More)
+
+	// Going back from the last page returns the page before it
+	prev, err := manager.Page(context.Background(), PageRequest{Limit: 2, Cursor: last.Logs[0].ReceivedAt, Direction: Newer})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2"}, messages(prev.Logs))
+	assert.True(t, prev.More)
+}
+
+func TestLogManager_PageFilter(t *testing.T) {
+	manager := NewLogManager(10, nil)
+	writeLogs(t, manager, 1, 9)
+
+	pattern := "^[13579]$"
+	page, err := manager.Page(context.Background(), PageRequest{
+		Limit:  3,
+		Filter: &Filter{Message: &database.FieldFilter[string]{Eq: &pattern}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"9", "7", "5"}, messages(page.Logs))
+
+	invalid := "("
+	_, err = manager.Page(context.Background(), PageRequest{Limit: 3, Filter: &Filter{Message: &database.FieldFilter[string]{Eq: &invalid}}})
+	assert.Error(t, err)
+}
+
+func TestLogManager_PageDatabase(t *testing.T) {
+	db := &testDatabase{}
+	manager := NewLogManager(3, db)
+
+	// The database holds every log, the buffer only the last three
+	for i := 1; i <= 6; i++ {
+		log := &Log{Level: core.INFO, Message: fmt.Sprint(i)}
+		assert.NoError(t, manager.Write(log))
+		db.logs = append(db.logs, log)
+	}
+
+	page, err := manager.Page(context.Background(), PageRequest{Limit: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"6", "5", "4", "3"}, messages(page.Logs))
+	assert.True(t, page.More)
+
+	page, err = manager.Page(context.Background(), PageRequest{Limit: 4, Cursor: page.Logs[3].ReceivedAt})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, messages(page.Logs))
+	assert.False(t, page.More)
+
+	page, err = manager.Page(context.Background(), PageRequest{Limit: 4, Cursor: page.Logs[1].ReceivedAt, Direction: Newer})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5", "4", "3", "2"}, messages(page.Logs))
+	assert.True(t, page.More)
+}
+
+func TestLogManager_PageDatabaseError(t *testing.T) {
+	db := &testDatabase{err: errors.New("connection lost")}
+	manager := NewLogManager(3, db)
+	writeLogs(t, manager, 1, 5)
+
+	// The buffer has enough logs for the page, so the database is not read
+	page, err := manager.Page(context.Background(), PageRequest{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5", "4"}, messages(page.Logs))
+
+	_, err = manager.Page(context.Background(), PageRequest{Limit: 5})
+	assert.ErrorIs(t, err, db.err)
+}
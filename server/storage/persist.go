@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/m4tth3/loggui/server/database"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Logs written to a LogManager with a database are persisted in the
+// background. They are batched, written with a bounded number of retries,
+// and passed to a dead letter if they still cannot be written, so that a
+// failing database never blocks or loses a write.
+
+const (
+	DefaultPersistBatchSize     = 100
+	DefaultPersistFlushInterval = time.Second
+	DefaultPersistMaxRetries    = 3
+	DefaultPersistMinBackoff    = 100 * time.Millisecond
+	DefaultPersistMaxBackoff    = 5 * time.Second
+)
+
+var ErrClosed = errors.New("log manager is closed")
+
+// DeadLetter is passed the logs which could not be persisted, along with the
+// last error returned writing them. It is called from a single goroutine.
+type DeadLetter func(logs []*Log, err error)
+
+// PersistConfig configures how a LogManager persists its logs. Every field
+// falls back to its default when left empty.
+type PersistConfig struct {
+	// BatchSize is the number of logs written to the database at a time.
+	BatchSize int
+
+	// FlushInterval is the longest a log waits before its batch is written,
+	// even if the batch is not full.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of logs waiting to be persisted. Writes block
+	// while the queue is full. Defaults to the size of the buffer.
+	QueueSize int
+
+	// MaxRetries is the number of times the logs of a batch which failed
+	// are written again. Set to a negative value to disable retries.
+	MaxRetries int
+
+	// MinBackoff is the delay before the first retry. It doubles on every
+	// further retry up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// DeadLetter is passed the logs which are not persisted once the
+	// retries run out. Defaults to writing them to stderr as JSON lines.
+	DeadLetter DeadLetter
+}
+
+func (c PersistConfig) withDefaults(size uint) PersistConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultPersistBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultPersistFlushInterval
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = int(size)
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	} else if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultPersistMaxRetries
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = DefaultPersistMinBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = max(DefaultPersistMaxBackoff, c.MinBackoff)
+	}
+	if c.DeadLetter == nil {
+		c.DeadLetter = DeadLetterWriter(os.Stderr)
+	}
+
+	return c
+}
+
+// DeadLetterWriter returns a DeadLetter writing each log to w as a line of
+// JSON, so that they can be ingested again later. Writes are serialised.
+func DeadLetterWriter(w io.Writer) DeadLetter {
+	var mutex sync.Mutex
+
+	return func(logs []*Log, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		encoder := json.NewEncoder(w)
+		for _, log := range logs {
+			_ = encoder.Encode(log)
+		}
+	}
+}
+
+// PersistStats are the counters of the logs persisted by a LogManager.
+//
+// Persisted is the number of logs written to the database, Retried is the
+// number of times a batch was written again after a failure, and
+// DeadLettered is the number of logs passed to the dead letter.
+type PersistStats struct {
+	Persisted    uint64
+	Retried      uint64
+	DeadLettered uint64
+}
+
+// PersistStats returns the persistence counters since the manager was
+// created. They are all zero without a database.
+func (l *LogManager) PersistStats() PersistStats {
+	return PersistStats{
+		Persisted:    l.persisted.Load(),
+		Retried:      l.retried.Load(),
+		DeadLettered: l.deadLettered.Load(),
+	}
+}
+
+// Close stops accepting writes and waits for every log written so far to
+// be persisted. If ctx is done first, the retries are abandoned and every
+// log not yet persisted is passed to the dead letter, after which
+// ctx.Err() is returned. Either way no log is lost once Close returns.
+func (l *LogManager) Close(ctx context.Context) error {
+	l.writeLock.Lock()
+	if l.closed {
+		l.writeLock.Unlock()
+		return ErrClosed
+	}
+
+	l.closed = true
+	l.writeLock.Unlock()
+
+	if l.db == nil {
+		return nil
+	}
+
+	// Writes still waiting for room in the queue get it as persist drains
+	// it, which is quick once aborted
+	go func() {
+		l.queueing.Wait()
+		close(l.writeChannel)
+	}()
+
+	select {
+	case <-l.persistDone:
+		return nil
+	case <-ctx.Done():
+		l.abort()
+		<-l.persistDone
+		return ctx.Err()
+	}
+}
+
+// persist owns the current batch. It writes it when it is full or when the
+// flush interval elapses, and writes what is left once the write channel
+// is closed.
+func (l *LogManager) persist() {
+	defer close(l.persistDone)
+
+	ticker := time.NewTicker(l.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Log, 0, l.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		l.writeBatch(batch)
+		batch = make([]*Log, 0, l.config.BatchSize)
+	}
+
+	for {
+		select {
+		case log, ok := <-l.writeChannel:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, log)
+			if len(batch) >= l.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// writeBatch writes the batch, retrying the logs which failed with an
+// exponential backoff. Those still failing when the retries run out, or
+// when Close gives up waiting, are passed to the dead letter.
+func (l *LogManager) writeBatch(batch []*Log) {
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if l.aborted.Err() != nil {
+			err = errors.Join(err, l.aborted.Err())
+			break
+		}
+
+		batch, err = l.writeLogs(batch)
+		if err == nil {
+			return
+		}
+
+		if attempt >= l.config.MaxRetries {
+			break
+		}
+
+		select {
+		case <-time.After(persistBackoff(attempt+1, l.config.MinBackoff, l.config.MaxBackoff)):
+			l.retried.Add(1)
+		case <-l.aborted.Done():
+		}
+	}
+
+	l.unpend(batch)
+	l.deadLettered.Add(uint64(len(batch)))
+	l.config.DeadLetter(batch, err)
+}
+
+// writeLogs writes the logs as a batch. It returns those which failed and
+// the error, which is a *database.BatchError if only some of them did.
+//
+// Those written are no longer pending once it returns, and persistLock is
+// held until then so that count never sees them in both places.
+func (l *LogManager) writeLogs(logs []*Log) ([]*Log, error) {
+	l.persistLock.Lock()
+	defer l.persistLock.Unlock()
+
+	err := l.db.WriteLogs(l.aborted, logs)
+	if err == nil {
+		l.unpend(logs)
+		l.persisted.Add(uint64(len(logs)))
+		return nil, nil
+	}
+
+	var batchErr *database.BatchError
+	if !errors.As(err, &batchErr) {
+		return logs, err
+	}
+
+	var failed, written []*Log
+	for i, log := range logs {
+		if _, ok := batchErr.Failed[i]; ok {
+			failed = append(failed, log)
+		} else {
+			written = append(written, log)
+		}
+	}
+
+	l.unpend(written)
+
+	l.persisted.Add(uint64(len(logs) - len(failed)))
+	return failed, err
+}
+
+// unpend removes the logs from those pending
+func (l *LogManager) unpend(logs []*Log) {
+	l.pendingLock.Lock()
+	defer l.pendingLock.Unlock()
+
+	for _, log := range logs {
+		delete(l.pending, log)
+	}
+}
+
+// persistBackoff returns the delay before the given retry (starting at 1).
+// The delay doubles from lo on every retry and is capped at hi.
+func persistBackoff(retry int, lo, hi time.Duration) time.Duration {
+	delay := lo
+	for i := 1; i < retry && delay < hi; i++ {
+		delay *= 2
+	}
+
+	return min(delay, hi)
+}
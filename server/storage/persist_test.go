@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyDatabase records the logs written to it. Writes fail while failures
+// is above zero, and always for the logs fail returns true for. A whole
+// batch fails while batchFailures is above zero.
+type flakyDatabase struct {
+	testDatabase
+
+	mutex         sync.Mutex
+	written       []*Log
+	failures      int
+	batchFailures int
+	fail          func(log *Log) bool
+}
+
+func (d *flakyDatabase) WriteLog(log *core.Log) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.failures > 0 {
+		d.failures--
+		return errors.New("database unavailable")
+	}
+
+	if d.fail != nil && d.fail(log) {
+		return errors.New("log rejected")
+	}
+
+	d.written = append(d.written, log)
+	return nil
+}
+
+func (d *flakyDatabase) WriteLogs(ctx context.Context, logs []*core.Log) error {
+	d.mutex.Lock()
+	if d.batchFailures > 0 {
+		d.batchFailures--
+		d.mutex.Unlock()
+		return errors.New("connection lost")
+	}
+	d.mutex.Unlock()
+
+	return database.WriteEach(ctx, logs, d.WriteLog)
+}
+
+func (d *flakyDatabase) messages() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return messages(d.written)
+}
+
+// deadLetters collects the logs passed to its DeadLetter
+type deadLetters struct {
+	mutex sync.Mutex
+	logs  []*Log
+}
+
+func (d *deadLetters) add(logs []*Log, _ error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.logs = append(d.logs, logs...)
+}
+
+func TestLogManager_Persist(t *testing.T) {
+	db := &flakyDatabase{}
+	manager := NewLogManagerWithConfig(10, db, PersistConfig{BatchSize: 4, FlushInterval: time.Hour})
+	writeLogs(t, manager, 1, 10)
+
+	// Every log is persisted on Close, including the partial last batch
+	assert.NoError(t, manager.Close(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, db.messages())
+	assert.Equal(t, PersistStats{Persisted: 10}, manager.PersistStats())
+
+	assert.ErrorIs(t, manager.Write(&Log{Message: "11"}), ErrClosed)
+	assert.ErrorIs(t, manager.Close(context.Background()), ErrClosed)
+}
+
+func TestLogManager_PersistFlushInterval(t *testing.T) {
+	db := &flakyDatabase{}
+	manager := NewLogManagerWithConfig(10, db, PersistConfig{FlushInterval: 10 * time.Millisecond})
+	defer manager.Close(context.Background())
+
+	writeLogs(t, manager, 1, 3)
+
+	assert.Eventually(t, func() bool {
+		return len(db.messages()) == 3
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestLogManager_PersistRetry(t *testing.T) {
+	db := &flakyDatabase{failures: 2}
+	dead := &deadLetters{}
+	manager := NewLogManagerWithConfig(10, db, PersistConfig{
+		MaxRetries: 3,
+		MinBackoff: time.Millisecond,
+		DeadLetter: dead.add,
+	})
+	writeLogs(t, manager, 1, 3)
+
+	// The first two writes fail, and only those logs are written again
+	assert.NoError(t, manager.Close(context.Background()))
+	assert.Equal(t, []string{"3", "1", "2"}, db.messages())
+	assert.Empty(t, dead.logs)
+
+	stats := manager.PersistStats()
+	assert.Equal(t, uint64(3), stats.Persisted)
+	assert.Equal(t, uint64(1), stats.Retried)
+}
+
+func TestLogManager_PersistBatchFailure(t *testing.T) {
+	db := &flakyDatabase{batchFailures: 2}
+	manager := NewLogManagerWithConfig(10, db, PersistConfig{MinBackoff: time.Millisecond})
+	writeLogs(t, manager, 1, 3)
+
+	// A batch which failed as a whole is written again as a whole
+	assert.NoError(t, manager.Close(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3"}, db.messages())
+	assert.Equal(t, PersistStats{Persisted: 3, Retried: 2}, manager.PersistStats())
+}
+
+func TestLogManager_PersistDeadLetter(t *testing.T) {
+	db := &flakyDatabase{fail: func(log *Log) bool { return log.Message == "2" }}
+	dead := &deadLetters{}
+	manager := NewLogManagerWithConfig(10, db, PersistConfig{
+		MaxRetries: 2,
+		MinBackoff: time.Millisecond,
+		DeadLetter: dead.add,
+	})
+	writeLogs(t, manager, 1, 3)
+
+	assert.NoError(t, manager.Close(context.Background()))
+	assert.Equal(t, []string{"1", "3"}, db.messages())
+	assert.Equal(t, []string{"2"}, messages(dead.logs))
+	assert.Equal(t, PersistStats{Persisted: 2, Retried: 2, DeadLettered: 1}, manager.PersistStats())
+
+	// A log which could not be persisted is still in the buffer
+	page, err := manager.Page(context.Background(), PageRequest{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "1"}, messages(page.Logs))
+}
+
+func TestLogManager_CloseTimeout(t *testing.T) {
+	db := &flakyDatabase{failures: 1000}
+	dead := &deadLetters{}
+	manager := NewLogManagerWithConfig(10, db, PersistConfig{
+		BatchSize:  2,
+		MaxRetries: 100,
+		MinBackoff: time.Hour,
+		DeadLetter: dead.add,
+	})
+	writeLogs(t, manager, 1, 5)
+
+	// Giving up on the retries passes everything left to the dead letter
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, manager.Close(ctx), context.DeadlineExceeded)
+	assert.Empty(t, db.messages())
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4", "5"}, messages(dead.logs))
+	assert.Equal(t, uint64(5), manager.PersistStats().DeadLettered)
+}
+
+// stalledDatabase blocks every batch write until its context is done
+type stalledDatabase struct {
+	testDatabase
+
+	started chan struct{}
+	once    sync.Once
+}
+
+func (d *stalledDatabase) WriteLogs(ctx context.Context, logs []*core.Log) error {
+	d.once.Do(func() { close(d.started) })
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestLogManager_CloseWithFullQueue(t *testing.T) {
+	db := &stalledDatabase{started: make(chan struct{})}
+	dead := &deadLetters{}
+	manager := NewLogManagerWithConfig(10, db, PersistConfig{
+		BatchSize:  1,
+		QueueSize:  1,
+		DeadLetter: dead.add,
+	})
+
+	writeLogs(t, manager, 1, 1)
+	<-db.started
+
+	// The queue has room for one more, so the writes after it block
+	var wg sync.WaitGroup
+	for i := 2; i <= 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = manager.Write(&Log{Message: fmt.Sprint(i)})
+		}()
+	}
+
+	assert.Eventually(t, func() bool {
+		page, err := manager.Page(context.Background(), PageRequest{Limit: 10})
+		return err == nil && len(page.Logs) == 4
+	}, time.Second, time.Millisecond)
+
+	// Readers are not held up by the blocked writes
+	assert.NotNil(t, manager.GetReader(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	closed := make(chan error, 1)
+	go func() { closed <- manager.Close(ctx) }()
+
+	select {
+	case err := <-closed:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return once its context expired")
+	}
+
+	wg.Wait()
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4"}, messages(dead.logs))
+}
+
+func TestLogManager_CloseWithoutDatabase(t *testing.T) {
+	manager := NewLogManager(10, nil)
+	writeLogs(t, manager, 1, 3)
+
+	assert.NoError(t, manager.Close(context.Background()))
+	assert.ErrorIs(t, manager.Write(&Log{Message: "4"}), ErrClosed)
+	assert.Equal(t, PersistStats{}, manager.PersistStats())
+}
+
+func TestDeadLetterWriter(t *testing.T) {
+	var out bytes.Buffer
+	DeadLetterWriter(&out)([]*Log{
+		{Level: core.WARN, Message: "1"},
+		{Level: core.ERROR, Message: "2"},
+	}, errors.New("failed"))
+
+	decoder := json.NewDecoder(&out)
+	for _, message := range []string{"1", "2"} {
+		var log Log
+		assert.NoError(t, decoder.Decode(&log))
+		assert.Equal(t, message, log.Message)
+	}
+	assert.False(t, decoder.More())
+}
@@ -42,8 +42,8 @@ func (e *Element[T]) Value() *T {
 // Example: [1, 2, 3] if i = 0, then with offset 0 we get item at index 1
 func (e *Element[T]) Next(offset uint) *Element[T] {
 	offset++
-	if uint64(offset) > e.counter {
-		// no possible item to read
+	if uint64(offset) > e.counter || offset >= e.buffer.Capacity() {
+		// no possible item to read, or it has already been overwritten
 		return nil
 	}
 
@@ -159,6 +159,12 @@ func (l *RingBuffer[T]) ElementAndListener(ctx context.Context) (*Element[T], <-
 
 	go func() {
 		<-newCtx.Done()
+
+		// Write sends to the listeners while holding the lock, so closing
+		// under it makes sure nothing is sent on the closed channel
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
 		l.listeners.Delete(c)
 		close(c)
 	}()
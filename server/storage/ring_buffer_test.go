@@ -358,6 +358,13 @@ func TestRingBuffer_Next_WithDifferentOffsets(t *testing.T) {
 	// Next(4) should return nil (out of bounds)
 	el5 := el.Next(4)
 	assert.Nil(t, el5)
+
+	// Offsets past the capacity are out of bounds even after wrapping
+	for _, v := range values {
+		buffer.Write(&v)
+	}
+	assert.Nil(t, buffer.Element().Next(5))
+	assert.Nil(t, buffer.Element().Next(100))
 }
 
 func TestLoopAdd64(t *testing.T) {
@@ -0,0 +1,240 @@
+package server
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/m4tth3/loggui/server/storage"
+)
+
+const (
+	defaultHeartbeatInterval = 15 * time.Second
+
+	// resumePageSize is the number of logs read at a time when catching up
+	// from a Last-Event-ID
+	resumePageSize = 500
+)
+
+// streamHandler tails the logs as Server-Sent Events. It takes the same
+// filter parameters as the query endpoint, and first sends the last limit
+// matching logs, oldest first, before pushing new ones as they arrive.
+//
+// Every log is sent as a message event whose id is its ReceivedAt in
+// microseconds. A client reconnecting with Last-Event-ID is sent every
+// matching log after it instead of the last limit. A comment is sent every
+// heartbeat interval to keep the connection open.
+//
+// A client which falls too far behind is sent an overflow event and
+// disconnected, after which it can reconnect with Last-Event-ID to resume.
+//
+// GET /api/v1/logs/stream
+type streamHandler struct {
+	manager   *storage.LogManager
+	heartbeat time.Duration
+}
+
+func newStreamHandler(manager *storage.LogManager) *streamHandler {
+	return &streamHandler{
+		manager:   manager,
+		heartbeat: defaultHeartbeatInterval,
+	}
+}
+
+func (h *streamHandler) serveHTTP(c *context) {
+	req, err := parsePageRequest(c.URL.Query())
+	if err != nil {
+		c.writeError(http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+
+	var lastEventID *time.Time
+	if raw := c.Request.Header.Get("Last-Event-ID"); raw != "" {
+		micro, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.writeError(http.StatusBadRequest, "invalid_parameter", "Last-Event-ID is not valid")
+			return
+		}
+
+		t := time.UnixMicro(micro)
+		lastEventID = &t
+	}
+
+	if _, ok := c.ResponseWriter.(http.Flusher); !ok {
+		c.writeError(http.StatusInternalServerError, "streaming_unsupported", "response cannot be streamed")
+		return
+	}
+
+	header := c.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.WriteHeader(http.StatusOK)
+
+	// Subscribing before reading the backlog means no log can be missed in
+	// between. Logs in both are skipped by their ReceivedAt.
+	_, listener := h.manager.Subscribe(c.Request.Context())
+
+	var lastSent *time.Time
+	if lastEventID != nil {
+		lastSent, err = h.resume(c, req, *lastEventID)
+	} else {
+		lastSent, err = h.backlog(c, req)
+	}
+
+	if err != nil {
+		return
+	}
+
+	h.stream(c, req.Filter, lastSent, listener)
+}
+
+// backlog sends the last req.Limit matching logs.
+func (h *streamHandler) backlog(c *context, req *storage.PageRequest) (*time.Time, error) {
+	page, err := h.manager.Page(c.Request.Context(), *req)
+	if err != nil {
+		return nil, h.sendError(c, err)
+	}
+
+	var lastSent *time.Time
+	for i := len(page.Logs) - 1; i >= 0; i-- {
+		if err := h.sendLog(c, page.Logs[i]); err != nil {
+			return nil, err
+		}
+		lastSent = page.Logs[i].ReceivedAt
+	}
+
+	return lastSent, flush(c)
+}
+
+// resume sends every matching log received after the last event.
+func (h *streamHandler) resume(c *context, req *storage.PageRequest, lastEventID time.Time) (*time.Time, error) {
+	lastSent, err := replay(c.Request.Context(), h.manager, req.Filter, lastEventID, func(log *core.Log) error {
+		return h.sendLog(c, log)
+	})
+	if err != nil {
+		return nil, h.sendError(c, err)
+	}
+
+	return &lastSent, flush(c)
+}
+
+// replay passes every log matching the filter received after the cursor to
+// send, oldest first. It returns the ReceivedAt of the last log sent, or the
+// cursor if there were none.
+func replay(ctx stdcontext.Context, manager *storage.LogManager, filter *database.Filter, cursor time.Time, send func(*core.Log) error) (time.Time, error) {
+	for {
+		page, err := manager.Page(ctx, storage.PageRequest{
+			Filter:    filter,
+			Cursor:    &cursor,
+			Direction: storage.Newer,
+			Limit:     resumePageSize,
+		})
+		if err != nil {
+			return cursor, err
+		}
+
+		for i := len(page.Logs) - 1; i >= 0; i-- {
+			if err := send(page.Logs[i]); err != nil {
+				return cursor, err
+			}
+			cursor = *page.Logs[i].ReceivedAt
+		}
+
+		if !page.More {
+			return cursor, nil
+		}
+	}
+}
+
+// stream pushes the logs from the listener until the client disconnects or
+// falls behind.
+func (h *streamHandler) stream(c *context, filter *database.Filter, lastSent *time.Time, listener <-chan *core.Log) {
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case log, ok := <-listener:
+			if !ok {
+				if c.Request.Context().Err() == nil {
+					_ = h.sendEvent(c, "overflow", "", map[string]string{
+						"message": "client fell behind, reconnect with Last-Event-ID to resume",
+					})
+					_ = flush(c)
+				}
+				return
+			}
+
+			if lastSent != nil && !log.ReceivedAt.After(*lastSent) {
+				continue
+			}
+
+			if !filter.Filter(log) {
+				continue
+			}
+
+			if err := h.sendLog(c, log); err != nil {
+				return
+			}
+
+			// Drain whatever else is ready before flushing
+			if len(listener) > 0 {
+				continue
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.ResponseWriter, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := flush(c); err != nil {
+			return
+		}
+	}
+}
+
+func (h *streamHandler) sendLog(c *context, log *core.Log) error {
+	return h.sendEvent(c, "", strconv.FormatInt(log.ReceivedAt.UnixMicro(), 10), log)
+}
+
+// sendError reports an error once the stream has started, when a status
+// can no longer be sent.
+func (h *streamHandler) sendError(c *context, err error) error {
+	_ = h.sendEvent(c, "query_error", "", apiErrorBody{Code: "query_failed", Message: err.Error()})
+	_ = flush(c)
+	return err
+}
+
+// sendEvent writes a single event. An empty event is a message event.
+func (h *streamHandler) sendEvent(c *context, event, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(c.ResponseWriter, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+
+	if event != "" {
+		if _, err := fmt.Fprintf(c.ResponseWriter, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(c.ResponseWriter, "data: %s\n\n", data)
+	return err
+}
+
+func flush(c *context) error {
+	return http.NewResponseController(c.ResponseWriter).Flush()
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/stretchr/testify/assert"
+)
+
+type streamEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openStream connects to the stream endpoint and returns a channel of the
+// events received.
+func openStream(t *testing.T, s *Server, query, lastEventID string) <-chan streamEvent {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/logs/stream?"+query, nil)
+	req.SetBasicAuth(testUsername, testPassword)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan streamEvent)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+
+		var event streamEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				events <- event
+				event = streamEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	return events
+}
+
+func nextMessage(t *testing.T, events <-chan streamEvent) (streamEvent, *core.Log) {
+	select {
+	case event := <-events:
+		var log core.Log
+		assert.NoError(t, json.Unmarshal([]byte(event.data), &log))
+		return event, &log
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+		return streamEvent{}, nil
+	}
+}
+
+func TestStream_BacklogAndLive(t *testing.T) {
+	s := newTestServer()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, s.manager.Write(&core.Log{Level: core.INFO, Message: fmt.Sprint(i)}))
+	}
+
+	events := openStream(t, s, "limit=2", "")
+
+	for _, expected := range []string{"2", "3"} {
+		_, log := nextMessage(t, events)
+		assert.Equal(t, expected, log.Message)
+	}
+
+	assert.NoError(t, s.manager.Write(&core.Log{Level: core.INFO, Message: "4"}))
+
+	event, log := nextMessage(t, events)
+	assert.Equal(t, "4", log.Message)
+	assert.Equal(t, fmt.Sprint(log.ReceivedAt.UnixMicro()), event.id)
+}
+
+func TestStream_Filter(t *testing.T) {
+	s := newTestServer()
+	events := openStream(t, s, "level=error", "")
+
+	assert.NoError(t, s.manager.Write(&core.Log{Level: core.INFO, Message: "ignored"}))
+	assert.NoError(t, s.manager.Write(&core.Log{Level: core.ERROR, Message: "sent"}))
+
+	_, log := nextMessage(t, events)
+	assert.Equal(t, "sent", log.Message)
+}
+
+func TestStream_Resume(t *testing.T) {
+	s := newTestServer()
+
+	var first *core.Log
+	for i := 1; i <= 3; i++ {
+		log := &core.Log{Level: core.INFO, Message: fmt.Sprint(i)}
+		assert.NoError(t, s.manager.Write(log))
+		if first == nil {
+			first = log
+		}
+	}
+
+	events := openStream(t, s, "limit=1", fmt.Sprint(first.ReceivedAt.UnixMicro()))
+
+	for _, expected := range []string{"2", "3"} {
+		_, log := nextMessage(t, events)
+		assert.Equal(t, expected, log.Message)
+	}
+}
+
+func TestStream_Overflow(t *testing.T) {
+	h := newStreamHandler(nil)
+
+	// A listener closed while the request is alive means it fell behind
+	listener := make(chan *core.Log)
+	close(listener)
+
+	rec := httptest.NewRecorder()
+	c := newContext(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/stream", nil))
+	h.stream(c, &database.Filter{}, nil, listener)
+
+	assert.Contains(t, rec.Body.String(), "event: overflow\n")
+}
+
+func TestStream_Heartbeat(t *testing.T) {
+	h := newStreamHandler(nil)
+	h.heartbeat = time.Millisecond
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	listener := make(chan *core.Log)
+	go func() {
+		<-ctx.Done()
+		close(listener)
+	}()
+
+	rec := httptest.NewRecorder()
+	c := newContext(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/stream", nil).WithContext(ctx))
+	h.stream(c, &database.Filter{}, nil, listener)
+
+	assert.Contains(t, rec.Body.String(), ": heartbeat\n\n")
+	assert.NotContains(t, rec.Body.String(), "overflow")
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/m4tth3/loggui/core"
+	"github.com/m4tth3/loggui/server/database"
+	"github.com/m4tth3/loggui/server/storage"
+)
+
+const (
+	wsWriteTimeout   = 10 * time.Second
+	wsPongTimeout    = 60 * time.Second
+	wsPingInterval   = wsPongTimeout * 9 / 10
+	wsMaxMessageSize = 64 << 10
+
+	// wsMaxPendingChunks bounds the chunk requests waiting to be read, so
+	// requesting one never blocks on the reader
+	wsMaxPendingChunks = 8
+)
+
+// The messages the browser sends over the websocket
+const (
+	wsSubscribe = "subscribe"
+	wsFilter    = "filter"
+	wsPause     = "pause"
+	wsResume    = "resume"
+	wsChunk     = "chunk"
+)
+
+// The messages the server sends over the websocket
+const (
+	wsSubscribed = "subscribed"
+	wsLog        = "log"
+	wsChunkLogs  = "chunk"
+	wsPaused     = "paused"
+	wsResumed    = "resumed"
+	wsOverflow   = "overflow"
+	wsError      = "error"
+)
+
+// wsRequest is a message sent by the browser. Filter takes the same keys as
+// the query endpoint's parameters.
+type wsRequest struct {
+	Type   string            `json:"type"`
+	Filter map[string]string `json:"filter,omitempty"`
+	Chunk  storage.Chunk     `json:"chunk,omitempty"`
+}
+
+// wsMessage is a message sent to the browser. Subscription is the ID of the
+// subscription a log or chunk belongs to, so any sent before a filter
+// change can be told apart.
+type wsMessage struct {
+	Type         string         `json:"type"`
+	Subscription uint64         `json:"subscription,omitempty"`
+	Log          *core.Log      `json:"log,omitempty"`
+	Chunk        *storage.Chunk `json:"chunk,omitempty"`
+	Logs         []*core.Log    `json:"logs,omitempty"`
+	Last         bool           `json:"last,omitempty"`
+	Error        *apiErrorBody  `json:"error,omitempty"`
+}
+
+// websocketHandler carries the live feed and the chunked history of the
+// logs over a single websocket. The browser sends
+//
+//	{"type": "subscribe", "filter": {"level": "error"}} - start a subscription
+//	{"type": "filter", "filter": {...}}                 - replace its filter
+//	{"type": "pause"} / {"type": "resume"}              - hold the live feed
+//	{"type": "chunk", "chunk": 0}                       - request older logs
+//
+// and is sent subscribed, log, chunk, paused, resumed, overflow and error
+// messages. Chunks are read by a storage.LogReader anchored when the
+// subscription starts, and every log after the anchor is sent live. Logs
+// received while paused, or missed after falling behind, are sent on
+// resuming.
+//
+// GET /api/v1/logs/ws
+type websocketHandler struct {
+	manager  *storage.LogManager
+	upgrader websocket.Upgrader
+}
+
+func newWebsocketHandler(manager *storage.LogManager) *websocketHandler {
+	return &websocketHandler{manager: manager}
+}
+
+func (h *websocketHandler) serveHTTP(c *context) {
+	conn, err := h.upgrader.Upgrade(c.ResponseWriter, c.Request, nil)
+	if err != nil {
+		// The upgrader has already replied
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := stdcontext.WithCancel(c.Request.Context())
+	defer cancel()
+
+	s := &wsSession{
+		conn:    conn,
+		manager: h.manager,
+		ctx:     ctx,
+	}
+
+	s.run(h.readRequests(ctx, conn))
+}
+
+// readRequests reads the browser's messages until the connection fails or
+// ctx is done. A message which cannot be decoded is passed on with an empty
+// type.
+func (h *websocketHandler) readRequests(ctx stdcontext.Context, conn *websocket.Conn) <-chan wsRequest {
+	requests := make(chan wsRequest)
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	go func() {
+		defer close(requests)
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var req wsRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				req = wsRequest{}
+			}
+
+			// The session may have stopped reading, e.g. after a write
+			// failed
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return requests
+}
+
+// wsSession is the state of a single websocket. It is only used by the
+// goroutine running it, which is also the only one writing to the
+// connection.
+type wsSession struct {
+	conn    *websocket.Conn
+	manager *storage.LogManager
+	ctx     stdcontext.Context
+
+	subscription uint64
+	subCtx       stdcontext.Context
+	cancel       stdcontext.CancelFunc
+	filter       *database.Filter
+	reader       *storage.LogReader
+	chunks       <-chan *storage.LogChunk
+	pending      int
+	listener     <-chan *core.Log
+
+	paused   bool
+	lastSent time.Time
+}
+
+func (s *wsSession) run(requests <-chan wsRequest) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	defer func() {
+		if s.cancel != nil {
+			s.cancel()
+		}
+	}()
+
+	for {
+		var err error
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			err = s.handle(req)
+		case log, ok := <-s.listener:
+			if !ok {
+				err = s.overflow()
+				break
+			}
+			err = s.sendLive(log)
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				return
+			}
+			s.pending--
+			err = s.sendChunk(chunk)
+		case <-ping.C:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = s.conn.WriteMessage(websocket.PingMessage, nil)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle acts on a message from the browser. Only a failed write is
+// returned, anything else the browser did wrong is sent back to it.
+func (s *wsSession) handle(req wsRequest) error {
+	switch req.Type {
+	case wsSubscribe, wsFilter:
+		return s.subscribe(req.Filter)
+	case wsPause:
+		if s.reader == nil {
+			return s.sendError("not_subscribed", "subscribe before pausing")
+		}
+
+		s.paused = true
+		return s.send(wsMessage{Type: wsPaused, Subscription: s.subscription})
+	case wsResume:
+		if s.reader == nil {
+			return s.sendError("not_subscribed", "subscribe before resuming")
+		}
+
+		if !s.paused {
+			return s.send(wsMessage{Type: wsResumed, Subscription: s.subscription})
+		}
+
+		s.paused = false
+		if err := s.send(wsMessage{Type: wsResumed, Subscription: s.subscription}); err != nil {
+			return err
+		}
+		return s.catchUp()
+	case wsChunk:
+		if s.reader == nil {
+			return s.sendError("not_subscribed", "subscribe before requesting chunks")
+		}
+
+		if s.pending >= wsMaxPendingChunks {
+			return s.sendError("too_many_requests", "wait for the pending chunks first")
+		}
+
+		s.pending++
+		s.reader.RequestChunk(req.Chunk)
+		return nil
+	case "":
+		return s.sendError("malformed_message", "message must be a JSON object with a type")
+	default:
+		return s.sendError("unknown_message", "unknown message type "+req.Type)
+	}
+}
+
+// subscribe replaces the current subscription with one for the filter. A
+// filter which is not valid leaves the current subscription as it is.
+func (s *wsSession) subscribe(params map[string]string) error {
+	query := url.Values{}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+
+	req, err := parsePageRequest(query)
+	if err != nil {
+		return s.sendError("invalid_parameter", err.Error())
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	ctx, cancel := stdcontext.WithCancel(s.ctx)
+
+	// Subscribing before creating the reader means no log is missed in
+	// between. Logs older than the anchor are skipped by the live feed.
+	_, s.listener = s.manager.Subscribe(ctx)
+	s.reader = s.manager.GetReader(req.Filter)
+
+	s.chunks, err = s.reader.OpenStream(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	s.subscription++
+	s.pending = 0
+	s.subCtx = ctx
+	s.cancel = cancel
+	s.filter = req.Filter
+	s.paused = false
+	s.lastSent = s.reader.Anchor().Add(-time.Microsecond)
+
+	return s.send(wsMessage{Type: wsSubscribed, Subscription: s.subscription})
+}
+
+func (s *wsSession) sendLive(log *core.Log) error {
+	if s.paused || !log.ReceivedAt.After(s.lastSent) || !s.filter.Filter(log) {
+		return nil
+	}
+
+	s.lastSent = *log.ReceivedAt
+	return s.send(wsMessage{Type: wsLog, Subscription: s.subscription, Log: log})
+}
+
+// overflow resubscribes to the live feed after falling behind, and sends
+// the logs missed in the meantime unless paused.
+func (s *wsSession) overflow() error {
+	_, s.listener = s.manager.Subscribe(s.subCtx)
+
+	if err := s.send(wsMessage{Type: wsOverflow, Subscription: s.subscription}); err != nil {
+		return err
+	}
+
+	if s.paused {
+		return nil
+	}
+
+	return s.catchUp()
+}
+
+// catchUp sends the logs received since the last one sent.
+func (s *wsSession) catchUp() error {
+	var sendErr error
+
+	lastSent, err := replay(s.subCtx, s.manager, s.filter, s.lastSent, func(log *core.Log) error {
+		sendErr = s.send(wsMessage{Type: wsLog, Subscription: s.subscription, Log: log})
+		return sendErr
+	})
+	s.lastSent = lastSent
+
+	if sendErr != nil {
+		return sendErr
+	} else if err != nil {
+		return s.sendError("query_failed", err.Error())
+	}
+
+	return nil
+}
+
+func (s *wsSession) sendChunk(chunk *storage.LogChunk) error {
+	if chunk.Err != nil {
+		return s.sendError("query_failed", chunk.Err.Error())
+	}
+
+	return s.send(wsMessage{
+		Type:         wsChunkLogs,
+		Subscription: s.subscription,
+		Chunk:        &chunk.Chunk,
+		Logs:         chunk.Logs,
+		Last:         chunk.Last,
+	})
+}
+
+func (s *wsSession) sendError(code, message string) error {
+	return s.send(wsMessage{Type: wsError, Error: &apiErrorBody{Code: code, Message: message}})
+}
+
+func (s *wsSession) send(msg wsMessage) error {
+	_ = s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return s.conn.WriteJSON(msg)
+}
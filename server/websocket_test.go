@@ -0,0 +1,150 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/m4tth3/loggui/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func dialWebsocket(t *testing.T, s *Server) *websocket.Conn {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	header := http.Header{}
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(testUsername, testPassword)
+	header.Set("Authorization", req.Header.Get("Authorization"))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/logs/ws", header)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("ReadJSON() error = %v", err)
+	}
+
+	return msg
+}
+
+func writeLogs(t *testing.T, s *Server, level core.Level, messages ...string) {
+	for _, message := range messages {
+		assert.NoError(t, s.manager.Write(&core.Log{Level: level, Message: message}))
+	}
+}
+
+func TestWebsocket_LiveAndChunks(t *testing.T) {
+	s := newTestServer()
+	for i := 1; i <= 60; i++ {
+		writeLogs(t, s, core.INFO, fmt.Sprint(i))
+	}
+
+	conn := dialWebsocket(t, s)
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsSubscribe}))
+
+	msg := readMessage(t, conn)
+	assert.Equal(t, wsSubscribed, msg.Type)
+	assert.Equal(t, uint64(1), msg.Subscription)
+
+	writeLogs(t, s, core.INFO, "live")
+	msg = readMessage(t, conn)
+	assert.Equal(t, wsLog, msg.Type)
+	assert.Equal(t, "live", msg.Log.Message)
+
+	// Chunks stay anchored at the subscription, so the live log is not in them
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsChunk, Chunk: 0}))
+	msg = readMessage(t, conn)
+	assert.Equal(t, wsChunkLogs, msg.Type)
+	assert.Equal(t, uint64(0), *msg.Chunk)
+	assert.Len(t, msg.Logs, 50)
+	assert.Equal(t, "60", msg.Logs[0].Message)
+	assert.False(t, msg.Last)
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsChunk, Chunk: 1}))
+	msg = readMessage(t, conn)
+	assert.Len(t, msg.Logs, 10)
+	assert.True(t, msg.Last)
+}
+
+func TestWebsocket_Filter(t *testing.T) {
+	s := newTestServer()
+	conn := dialWebsocket(t, s)
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsSubscribe, Filter: map[string]string{"level": "error"}}))
+	assert.Equal(t, wsSubscribed, readMessage(t, conn).Type)
+
+	writeLogs(t, s, core.INFO, "ignored")
+	writeLogs(t, s, core.ERROR, "error")
+	assert.Equal(t, "error", readMessage(t, conn).Log.Message)
+
+	// A bad filter keeps the current subscription
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsFilter, Filter: map[string]string{"message": "("}}))
+	msg := readMessage(t, conn)
+	assert.Equal(t, wsError, msg.Type)
+	assert.Equal(t, "invalid_parameter", msg.Error.Code)
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsFilter, Filter: map[string]string{"level": "info"}}))
+	msg = readMessage(t, conn)
+	assert.Equal(t, wsSubscribed, msg.Type)
+	assert.Equal(t, uint64(2), msg.Subscription)
+
+	writeLogs(t, s, core.ERROR, "ignored")
+	writeLogs(t, s, core.INFO, "info")
+	msg = readMessage(t, conn)
+	assert.Equal(t, "info", msg.Log.Message)
+	assert.Equal(t, uint64(2), msg.Subscription)
+}
+
+func TestWebsocket_PauseResume(t *testing.T) {
+	s := newTestServer()
+	conn := dialWebsocket(t, s)
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsSubscribe}))
+	assert.Equal(t, wsSubscribed, readMessage(t, conn).Type)
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsPause}))
+	assert.Equal(t, wsPaused, readMessage(t, conn).Type)
+
+	writeLogs(t, s, core.INFO, "1", "2")
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsResume}))
+	assert.Equal(t, wsResumed, readMessage(t, conn).Type)
+
+	// The logs received while paused are sent on resuming, then the live
+	// feed carries on without repeating them
+	writeLogs(t, s, core.INFO, "3")
+	for _, expected := range []string{"1", "2", "3"} {
+		msg := readMessage(t, conn)
+		assert.Equal(t, wsLog, msg.Type)
+		assert.Equal(t, expected, msg.Log.Message)
+	}
+}
+
+func TestWebsocket_Errors(t *testing.T) {
+	s := newTestServer()
+	conn := dialWebsocket(t, s)
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: wsChunk}))
+	assert.Equal(t, "not_subscribed", readMessage(t, conn).Error.Code)
+
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("nope")))
+	assert.Equal(t, "malformed_message", readMessage(t, conn).Error.Code)
+
+	assert.NoError(t, conn.WriteJSON(wsRequest{Type: "shout"}))
+	assert.Equal(t, "unknown_message", readMessage(t, conn).Error.Code)
+}